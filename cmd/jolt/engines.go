@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+// runEnginesCmd handles "jolt engines": it lists the compiled-in engines,
+// their capabilities and whether they work on this system.
+func runEnginesCmd() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENGINE\tSTATUS\tCAPABILITIES\tFIO\tDESCRIPTION")
+	for _, r := range engine.Engines() {
+		status := "available"
+		if r.Available != nil {
+			if err := r.Available(); err != nil {
+				status = fmt.Sprintf("unavailable (%v)", err)
+			}
+		}
+		var caps []string
+		if r.Caps.Async {
+			caps = append(caps, "async")
+		}
+		if r.Caps.Trace {
+			caps = append(caps, "trace")
+		}
+		if r.Caps.Direct {
+			caps = append(caps, "direct")
+		}
+		if r.Caps.Simulated {
+			caps = append(caps, "simulated")
+		}
+		fio := r.Fio
+		if fio == "" {
+			fio = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, status, strings.Join(caps, ","), fio, r.Description)
+	}
+	w.Flush()
+}
+
+// newEngine returns the named engine, exiting if there is no such engine.
+func newEngine(engineType string) engine.Engine {
+	eng, err := engine.New(engineType)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return eng
+}
+
+// simulated reports whether the named engine models a device rather than
+// doing I/O, and so needs no target path.
+func simulated(engineType string) bool {
+	r, ok := engine.Lookup(engineType)
+	return ok && r.Caps.Simulated
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -15,6 +18,7 @@ import (
 	"github.com/runningwild/jolt/pkg/config"
 	"github.com/runningwild/jolt/pkg/engine"
 	"github.com/runningwild/jolt/pkg/optimize"
+	"github.com/runningwild/jolt/pkg/precondition"
 	"github.com/runningwild/jolt/pkg/sweep"
 )
 
@@ -31,12 +35,18 @@ func main() {
 		case "sustain":
 			runSustainCmd()
 			return
+		case "precondition":
+			runPreconditionCmd()
+			return
 		case "agent":
 			runAgentCmd()
 			return
 		case "remote":
 			runRemoteCmd()
 			return
+		case "engines":
+			runEnginesCmd()
+			return
 		}
 	}
 
@@ -56,10 +66,48 @@ type Flags struct {
 	BS          *int
 	Direct      *bool
 	ReadPct     *int
+	DiscardPct  *int
+	ZeroesPct   *int
 	RandIO      *bool
+	Dist        *string
+	BSSplit     *string
+	Offset      *int64
+	Length      *int64
+	WorkingSet  *int64
+	Disjoint    *bool
+	Rate        *float64
+	Arrival     *string
+	SpinWait    *bool
+	ThinkTime   *time.Duration
+	ThinkDist   *string
+	BurstIOs    *int
+	BurstIdle   *time.Duration
+	Verify      *string
+	Trace       *string
+	ReplaySpeed *float64
+	SyncMode    *string
+	CPUs        *string
+	FsyncEvery  *int
+	Fdatasync   *bool
+	CompressRatio *float64
+	DedupePct   *int
+	RefillEvery *int
+	FixedBufs   *bool
+	FixedFiles  *bool
+	SQPoll      *bool
+	SQPollIdle  *time.Duration
+	IOPoll      *bool
+	SubmitBatch *int
+	CompleteBatch *int
+	RampTime    *time.Duration
 	MinRuntime  *time.Duration
 	MaxRuntime  *time.Duration
 	ErrorTarget *float64
+	StopRule    *string
+	StopIOs     *int64
+	SeriesInterval *time.Duration
+	SeriesLog   *string
+	SeriesFormat *string
 
 	// Search Params
 	VarName    *string
@@ -79,17 +127,55 @@ func SetupFlags(fs *flag.FlagSet) *Flags {
 	f.WriteConfig = fs.String("write-config", "", "Save the generated configuration to this YAML file")
 
 	f.Path = fs.String("path", "", "Path to device or file")
-	f.EngineType = fs.String("engine", "sync", "I/O engine: 'sync', 'uring', or 'libaio'")
+	f.EngineType = fs.String("engine", engine.DefaultEngine, "I/O engine: "+strings.Join(engine.Names(), ", ")+" (see 'jolt engines')")
+	f.Trace = fs.String("trace", "", "I/O trace to replay with -engine replay (CSV 'seconds,offset,size,R|W' or blkparse output)")
+	f.ReplaySpeed = fs.Float64("replay-speed", 0, "Trace replay speed: 0 = as fast as possible, 1 = original timing, 2 = twice as fast")
 	f.BS = fs.Int("bs", 4096, "Block size")
+	f.BSSplit = fs.String("bssplit", "", "Mixed block sizes in fio bssplit syntax, e.g. '4k/60:64k/30:1m/10' or '<reads>,<writes>' (overrides -bs)")
 	f.Direct = fs.Bool("direct", true, "Use O_DIRECT")
+	f.SyncMode = fs.String("sync-mode", "", "Open the target with O_DSYNC ('dsync') or O_SYNC ('sync')")
+	f.CPUs = fs.String("cpus", "", "Pin each worker to one CPU from a list ('0-3,8'), NUMA node ('node:1') or the target's node ('local'); buffers go on the node")
+	f.FsyncEvery = fs.Int("fsync", 0, "Flush after every N writes of each worker (sync and uring engines; 0 = never)")
+	f.Fdatasync = fs.Bool("fdatasync", false, "Flush with fdatasync instead of fsync")
+	f.CompressRatio = fs.Float64("compress-ratio", 0, "Write random data compressible by this ratio, e.g. 2 for 2:1 or 1 for incompressible (0 = zeroed buffers)")
+	f.DedupePct = fs.Int("dedupe-pct", 0, "Percentage of written 4KiB blocks that duplicate others")
+	f.RefillEvery = fs.Int("refill-every", 0, "Regenerate write data every N writes of a buffer (0 = every write)")
+	f.FixedBufs = fs.Bool("fixed-bufs", false, "io_uring: register I/O buffers with the ring")
+	f.FixedFiles = fs.Bool("fixed-files", false, "io_uring: register the target file with the ring")
+	f.SQPoll = fs.Bool("sqpoll", false, "io_uring: submit through a kernel SQ polling thread")
+	f.SQPollIdle = fs.Duration("sqpoll-idle", 0, "io_uring: SQ polling thread idle time before it sleeps (0 = kernel default)")
+	f.IOPoll = fs.Bool("iopoll", false, "io_uring: busy-poll for completions (requires -direct)")
+	f.SubmitBatch = fs.Int("submit-batch", 1, "io_uring: SQEs to queue before submitting")
+	f.CompleteBatch = fs.Int("complete-batch", 1, "io_uring: completions to wait for at once")
 			f.ReadPct = fs.Int("read-pct", 100, "Read percentage (0-100)")
+			f.DiscardPct = fs.Int("discard-pct", 0, "Percentage of all operations that are discards/TRIM (sync engine); -read-pct splits the rest")
+			f.ZeroesPct = fs.Int("write-zeroes-pct", 0, "Percentage of all operations that are write-zeroes (sync engine)")
 			f.RandIO = fs.Bool("rand", true, "Random I/O (default is sequential)")
+			f.Rate = fs.Float64("rate", 0, "Open-loop target IOPS; latency is measured from the scheduled start (0 = closed loop)")
+			f.Arrival = fs.String("arrival", "fixed", "Open-loop arrival process: 'fixed' or 'poisson'")
+			f.SpinWait = fs.Bool("spin-wait", false, "Spin before each scheduled I/O instead of relying on timers alone: more precise, but can use a core per worker")
+			f.ThinkTime = fs.Duration("think-time", 0, "Pause of each worker between its I/Os (closed loop)")
+			f.ThinkDist = fs.String("think-dist", "fixed", "Think time distribution: 'fixed' or 'exp' (exponential with -think-time as the mean)")
+			f.BurstIOs = fs.Int("burst-ios", 0, "Issue I/Os in bursts of N per worker, idling -burst-idle once each burst has completed (0 = no bursts)")
+			f.BurstIdle = fs.Duration("burst-idle", 0, "Idle time between bursts of -burst-ios I/Os")
+			f.Offset = fs.Int64("offset", 0, "Start of the I/O region in bytes")
+			f.Length = fs.Int64("length", 0, "Size of the I/O region in bytes (0 = to the end of the target)")
+			f.WorkingSet = fs.Int64("working-set", 0, "Bytes of the region actually touched, from its start (0 = all of it)")
+			f.Disjoint = fs.Bool("disjoint", false, "Give each worker its own slice of the region instead of sharing it")
+			f.Verify = fs.String("verify", "", "Verify written data: 'inline' (check blocks as they are read) or 'pass' (also re-read all written blocks afterwards)")
+			f.Dist = fs.String("dist", "uniform", "Random offset distribution: 'uniform', 'zipf:<theta>', 'pareto:<h>', 'normal:<dev%>', 'zoned:<io%>/<space%>:...'")
 			
+			f.RampTime = fs.Duration("ramp-time", 0, "Warm-up time for each test point during which I/O runs but isn't measured")
 			f.MinRuntime = fs.Duration("min-runtime", 1*time.Second, "Minimum runtime for each test point")
 			f.MaxRuntime = fs.Duration("max-runtime", 5*time.Second, "Maximum runtime for each test point")
 	f.ErrorTarget = fs.Float64("error", 0.05, "Target relative error (stdErr/mean), e.g., 0.05 for 5%")
+	f.StopRule = fs.String("stop-rule", "stderr", "When a test point has converged: 'stderr', 'batch_means', 'p99_ci' (P99 latency), 'plateau' (IOPS trend) or 'io_count' (after -stop-ios I/Os)")
+	f.StopIOs = fs.Int64("stop-ios", 0, "I/Os per test point for -stop-rule io_count")
+	f.SeriesInterval = fs.Duration("series-interval", 0, "Record IOPS, bandwidth and P50/P99 latency per interval of each test point, e.g. 1s (0 = off)")
+	f.SeriesLog = fs.String("series-log", "", "Write each test point's time series to <prefix>_<n>.csv (or .json), like fio's iops/lat logs")
+	f.SeriesFormat = fs.String("series-format", "csv", "Format of -series-log files: 'csv' or 'json'")
 
-	f.VarName = fs.String("var", "workers", "Variable to optimize: 'workers', 'queue_depth', 'block_size'")
+	f.VarName = fs.String("var", "workers", "Variable to optimize: 'workers', 'queue_depth', 'block_size', 'target_iops', 'discard_pct', or an io_uring knob: 'sqpoll', 'sqpoll_idle' (ms), 'iopoll', 'fixed_bufs', 'fixed_files', 'submit_batch', 'complete_batch'")
 	f.MinVal = fs.Int("min", 1, "Minimum value for the variable")
 	f.MaxVal = fs.Int("max", 32, "Maximum value for the variable")
 	f.StepVal = fs.Int("step", 1, "Step value for the variable")
@@ -103,6 +189,11 @@ f.ReportFile = fs.String("report", "", "Write results to JSON file")
 
 // LoadConfig determines the config source (file or flags) and returns a Config object.
 func (f *Flags) LoadConfig() (*config.Config, error) {
+	// Output flags apply either way; catch mistakes before any test runs.
+	if *f.SeriesFormat != "csv" && *f.SeriesFormat != "json" {
+		return nil, fmt.Errorf("unknown -series-format %q (want csv or json)", *f.SeriesFormat)
+	}
+
 	// 1. If -config is provided, load it
 	if *f.ConfigFile != "" {
 		cfg, err := config.Load(*f.ConfigFile)
@@ -113,8 +204,8 @@ func (f *Flags) LoadConfig() (*config.Config, error) {
 		return cfg, nil
 	}
 
-	// 2. Build Config from Flags
-	if *f.Path == "" {
+	// 2. Build Config from Flags. The simulated device needs no target.
+	if *f.Path == "" && !simulated(*f.EngineType) {
 		return nil, fmt.Errorf("-path is required when using flags")
 	}
 
@@ -127,10 +218,46 @@ func (f *Flags) LoadConfig() (*config.Config, error) {
 			EngineType:  *f.EngineType,
 			Direct:      *f.Direct,
 			ReadPct:     *f.ReadPct,
+			DiscardPct:  *f.DiscardPct,
+			WriteZeroesPct: *f.ZeroesPct,
 			Rand:        *f.RandIO,
+			Distribution: *f.Dist,
+			BSSplit:     *f.BSSplit,
+			Offset:      *f.Offset,
+			Length:      *f.Length,
+			WorkingSet:  *f.WorkingSet,
+			Disjoint:    *f.Disjoint,
+			TargetIOPS:  *f.Rate,
+			Arrival:     *f.Arrival,
+			SpinWait:    *f.SpinWait,
+			ThinkTime:   *f.ThinkTime,
+			ThinkDist:   *f.ThinkDist,
+			BurstIOs:    *f.BurstIOs,
+			BurstIdle:   *f.BurstIdle,
+			Verify:      *f.Verify,
+			Trace:       *f.Trace,
+			ReplaySpeed: *f.ReplaySpeed,
+			SyncMode:    *f.SyncMode,
+			CPUs:        *f.CPUs,
+			FsyncEvery:  *f.FsyncEvery,
+			Fdatasync:   *f.Fdatasync,
+			CompressRatio: *f.CompressRatio,
+			DedupePct:   *f.DedupePct,
+			RefillEvery: *f.RefillEvery,
+			FixedBufs:   *f.FixedBufs,
+			FixedFiles:  *f.FixedFiles,
+			SQPoll:      *f.SQPoll,
+			SQPollIdle:  *f.SQPollIdle,
+			IOPoll:      *f.IOPoll,
+			SubmitBatch: *f.SubmitBatch,
+			CompleteBatch: *f.CompleteBatch,
+			RampTime:    *f.RampTime,
 			MinRuntime:  *f.MinRuntime,
 			MaxRuntime:  *f.MaxRuntime,
 			ErrorTarget: *f.ErrorTarget,
+			StopRule:    *f.StopRule,
+			StopIOs:     *f.StopIOs,
+			SeriesInterval: *f.SeriesInterval,
 		},
 		Objectives: []config.Objective{
 			{Type: "maximize", Metric: "iops"},
@@ -192,7 +319,7 @@ func runDefaultOptimize() {
 
 
 
-	if *f.ConfigFile == "" && *f.Path == "" {
+	if *f.ConfigFile == "" && *f.Path == "" && !simulated(*f.EngineType) {
 
 		// If neither config nor path is provided, print help
 
@@ -216,7 +343,7 @@ func runDefaultOptimize() {
 
 	f.MaybeWriteConfig(cfg)
 
-	eng := engine.New(cfg.Settings.EngineType)
+	eng := newEngine(cfg.Settings.EngineType)
 
 	runOptimizeLogic(f, cfg, eng)
 
@@ -248,7 +375,7 @@ func runOptimizerCmd() {
 
 	f.MaybeWriteConfig(cfg)
 
-	eng := engine.New(cfg.Settings.EngineType)
+	eng := newEngine(cfg.Settings.EngineType)
 
 	runOptimizeLogic(f, cfg, eng)
 
@@ -258,17 +385,47 @@ func runOptimizerCmd() {
 
 func runOptimizeLogic(f *Flags, cfg *config.Config, eng engine.Engine) {
 
-	fmt.Printf("Optimizing %s using Coordinate Descent...\n", cfg.Target)
+	ctx := signalContext()
 
-	
+	pre := maybePrecondition(ctx, cfg, eng)
+
+	if ctx.Err() != nil {
+
+		if *f.ReportFile != "" {
+
+			writeReport(*f.ReportFile, nil, pre)
+
+		}
+
+		fmt.Printf("\n>>> Optimization Interrupted during preconditioning <<<\n")
+
+		os.Exit(130)
+
+	}
+
+	fmt.Printf("Optimizing %s using Coordinate Descent...\n", cfg.Target)
 
 	optimizer := optimize.NewCoordinate(eng, cfg)
 
-	
+	bestState, bestRes, err := optimizer.Optimize(ctx)
 
-	bestState, bestRes, err := optimizer.Optimize()
 
-	if err != nil {
+
+	// Whatever finished goes in the report, even if the run didn't.
+
+	if *f.ReportFile != "" {
+
+		writeReport(*f.ReportFile, optimizer.GetHistory(), pre)
+
+	}
+
+	if *f.SeriesLog != "" {
+
+		writeSeriesLogs(*f.SeriesLog, *f.SeriesFormat, optimizer.GetHistory())
+
+	}
+
+	if err != nil && ctx.Err() == nil {
 
 		fmt.Printf("Optimization failed: %v\n", err)
 
@@ -278,17 +435,27 @@ func runOptimizeLogic(f *Flags, cfg *config.Config, eng engine.Engine) {
 
 
 
-	fmt.Printf("\n>>> Optimization Complete <<<\n")
+	if ctx.Err() != nil {
 
-	fmt.Printf("Best State: %v\n", bestState)
+		fmt.Printf("\n>>> Optimization Interrupted <<<\n")
 
-	fmt.Printf("Metrics:    IOPS=%.0f, Throughput=%.2f MB/s\n", bestRes.IOPS, bestRes.Throughput/1024/1024)
+	} else {
 
+		fmt.Printf("\n>>> Optimization Complete <<<\n")
 
+	}
 
-	if *f.ReportFile != "" {
+	if bestState != nil {
 
-		writeReport(*f.ReportFile, optimizer.GetHistory())
+		fmt.Printf("Best State: %v\n", bestState)
+
+		fmt.Printf("Metrics:    IOPS=%.0f, Throughput=%.2f MB/s\n", bestRes.IOPS, bestRes.Throughput/1024/1024)
+
+	}
+
+	if ctx.Err() != nil {
+
+		os.Exit(130)
 
 	}
 
@@ -320,7 +487,7 @@ func runSweepCmd() {
 
 	f.MaybeWriteConfig(cfg)
 
-	eng := engine.New(cfg.Settings.EngineType)
+	eng := newEngine(cfg.Settings.EngineType)
 
 	runSweepLogic(f, cfg, eng)
 
@@ -330,13 +497,43 @@ func runSweepCmd() {
 
 func runSweepLogic(f *Flags, cfg *config.Config, eng engine.Engine) {
 
+	ctx := signalContext()
+
+	pre := maybePrecondition(ctx, cfg, eng)
+
+	if ctx.Err() != nil {
+
+		if *f.ReportFile != "" {
+
+			writeReport(*f.ReportFile, nil, pre)
+
+		}
+
+		fmt.Printf("\n>>> Sweep Interrupted during preconditioning <<<\n")
+
+		os.Exit(130)
+
+	}
+
 	s := sweep.New(eng, cfg)
 
 
 
-	history, knee, err := s.Run()
+	history, knee, err := s.Run(ctx)
 
-	if err != nil {
+	if *f.ReportFile != "" {
+
+		writeReport(*f.ReportFile, history, pre)
+
+	}
+
+	if *f.SeriesLog != "" {
+
+		writeSeriesLogs(*f.SeriesLog, *f.SeriesFormat, history)
+
+	}
+
+	if err != nil && ctx.Err() == nil {
 
 		fmt.Printf("Sweep failed: %v\n", err)
 
@@ -346,7 +543,15 @@ func runSweepLogic(f *Flags, cfg *config.Config, eng engine.Engine) {
 
 
 
-	fmt.Printf("\n>>> Sweep Complete <<<\n")
+	if ctx.Err() != nil {
+
+		fmt.Printf("\n>>> Sweep Interrupted after %d points <<<\n", len(history))
+
+	} else {
+
+		fmt.Printf("\n>>> Sweep Complete <<<\n")
+
+	}
 
 	if knee.OriginalX != nil {
 
@@ -358,11 +563,9 @@ func runSweepLogic(f *Flags, cfg *config.Config, eng engine.Engine) {
 
 	}
 
+	if ctx.Err() != nil {
 
-
-	if *f.ReportFile != "" {
-
-		writeReport(*f.ReportFile, history)
+		os.Exit(130)
 
 	}
 
@@ -546,7 +749,13 @@ func runRemoteCmd() {
 
 
 
-	
+	if cfg.Settings.Precondition != nil {
+
+		fmt.Println("Warning: settings.precondition is not supported for remote runs and will be skipped")
+
+		cfg.Settings.Precondition = nil
+
+	}
 
 
 
@@ -630,7 +839,11 @@ func runAgentCmd() {
 
 
 
-		srv := agent.NewServer("sync", *path) 
+		srv, err := agent.NewServer(engine.DefaultEngine, *path)
+		if err != nil {
+			fmt.Printf("Agent Startup Error: %v\n", err)
+			os.Exit(1)
+		}
 
 
 
@@ -710,7 +923,21 @@ func runAgentCmd() {
 
 
 
-func writeReport(path string, history []optimize.HistoryEntry) {
+// writeReport writes history to path as a JSON array. The rounds of pre, if
+// any, go to a report of their own next to it.
+func writeReport(path string, history []optimize.HistoryEntry, pre *precondition.Report) {
+
+	if pre != nil {
+
+		writePreconditionReport(preconditionReportPath(path), pre)
+
+	}
+
+	if history == nil {
+
+		history = []optimize.HistoryEntry{}
+
+	}
 
 	data, err := json.MarshalIndent(history, "", "  ")
 
@@ -733,3 +960,16 @@ func writeReport(path string, history []optimize.HistoryEntry) {
 	fmt.Printf("Report written to %s\n", path)
 
 }
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM, so
+// the test point in progress stops cleanly and what finished is kept. A
+// second signal kills jolt as usual.
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Printf("\nInterrupted, stopping the current test point (interrupt again to quit immediately)\n")
+	}()
+	return ctx
+}
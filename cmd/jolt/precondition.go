@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/runningwild/jolt/pkg/config"
+	"github.com/runningwild/jolt/pkg/engine"
+	"github.com/runningwild/jolt/pkg/precondition"
+)
+
+// runPreconditionCmd handles "jolt precondition [flags]"
+func runPreconditionCmd() {
+	fs := flag.NewFlagSet("precondition", flag.ExitOnError)
+	f := SetupFlags(fs)
+	skipFill := fs.Bool("skip-fill", false, "Skip the sequential fill and only run random-write rounds")
+	fillBS := fs.Int("fill-bs", 128*1024, "Block size for the sequential fill")
+	roundTime := fs.Duration("round-time", time.Minute, "Duration of each random-write round")
+	window := fs.Int("window", 5, "Number of rounds the steady-state criteria are checked over")
+	maxRounds := fs.Int("max-rounds", 25, "Give up after this many rounds")
+	fs.Parse(os.Args[2:])
+
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A precondition block in the config file wins; otherwise use the flags.
+	// The generic -bs/-workers/-queue-depth flags only apply if given, since
+	// their defaults are far too small to precondition a drive.
+	p := config.Precondition{
+		SkipFill:      *skipFill,
+		FillBlockSize: *fillBS,
+		RoundTime:     *roundTime,
+		Window:        *window,
+		MaxRounds:     *maxRounds,
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "bs":
+			p.BlockSize = *f.BS
+		case "workers":
+			p.Workers = *f.Workers
+		case "queue-depth":
+			p.QueueDepth = *f.QueueDepth
+		}
+	})
+	if cfg.Settings.Precondition != nil {
+		p = *cfg.Settings.Precondition
+	}
+
+	eng := newEngine(cfg.Settings.EngineType)
+	rep, runErr := precondition.New(eng, cfg, p).Run(signalContext())
+	if runErr != nil {
+		fmt.Printf("Preconditioning failed: %v\n", runErr)
+	}
+
+	// The rounds that finished are reported even if preconditioning didn't.
+	if *f.ReportFile != "" && rep != nil {
+		writePreconditionReport(*f.ReportFile, rep)
+	}
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
+
+// maybePrecondition runs settings.precondition, if any, before a test. If
+// ctx is cancelled it returns the rounds that finished, and the caller is
+// expected to report them and stop.
+func maybePrecondition(ctx context.Context, cfg *config.Config, eng engine.Engine) *precondition.Report {
+	if cfg.Settings.Precondition == nil {
+		return nil
+	}
+	rep, err := precondition.New(eng, cfg, *cfg.Settings.Precondition).Run(ctx)
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Preconditioning failed: %v\n", err)
+		os.Exit(1)
+	}
+	return rep
+}
+
+// preconditionReportPath returns where the preconditioning rounds of a test
+// reporting to path go: "results.json" becomes "results.precondition.json".
+func preconditionReportPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".precondition" + ext
+}
+
+// writePreconditionReport writes rep to path as JSON.
+func writePreconditionReport(path string, rep *precondition.Report) {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		fmt.Printf("Failed to marshal precondition report: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Printf("Failed to write precondition report: %v\n", err)
+		return
+	}
+	fmt.Printf("Precondition report written to %s\n", path)
+}
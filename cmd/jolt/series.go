@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/runningwild/jolt/pkg/engine"
+	"github.com/runningwild/jolt/pkg/optimize"
+)
+
+// writeSeriesLogs writes the time series of every evaluated point to
+// <prefix>_<n>.<format>, numbering points from 1 in the order they ran.
+// Points without a series (no -series-interval) are skipped. LoadConfig has
+// checked the format.
+func writeSeriesLogs(prefix, format string, history []optimize.HistoryEntry) {
+	written := 0
+	for i, h := range history {
+		if len(h.Result.Series) == 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		if format == "csv" {
+			if err := engine.WriteSeriesCSV(&buf, h.Result.Series); err != nil {
+				fmt.Printf("Failed to write time series: %v\n", err)
+				return
+			}
+		} else {
+			data, err := json.MarshalIndent(struct {
+				State  optimize.State
+				Series []engine.SeriesPoint
+			}{h.State, h.Result.Series}, "", "  ")
+			if err != nil {
+				fmt.Printf("Failed to write time series: %v\n", err)
+				return
+			}
+			buf.Write(data)
+		}
+		path := fmt.Sprintf("%s_%d.%s", prefix, i+1, format)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			fmt.Printf("Failed to write time series: %v\n", err)
+			return
+		}
+		written++
+	}
+	if written > 0 {
+		fmt.Printf("Time series of %d points written to %s_*.%s\n", written, prefix, format)
+	}
+}
@@ -37,7 +37,42 @@ func runSustainCmd() {
 		Path:       cfg.Target,
 		Direct:     cfg.Settings.Direct,
 		ReadPct:    cfg.Settings.ReadPct,
+		DiscardPct: cfg.Settings.DiscardPct,
+		WriteZeroesPct: cfg.Settings.WriteZeroesPct,
 		Rand:       cfg.Settings.Rand,
+		Distribution: cfg.Settings.Distribution,
+		BSSplit:    cfg.Settings.BSSplit,
+		Offset:     cfg.Settings.Offset,
+		Length:     cfg.Settings.Length,
+		WorkingSet: cfg.Settings.WorkingSet,
+		Disjoint:   cfg.Settings.Disjoint,
+		TargetIOPS: cfg.Settings.TargetIOPS,
+		Arrival:    cfg.Settings.Arrival,
+		SpinWait:   cfg.Settings.SpinWait,
+		ThinkTime:  cfg.Settings.ThinkTime,
+		ThinkDist:  cfg.Settings.ThinkDist,
+		BurstIOs:   cfg.Settings.BurstIOs,
+		BurstIdle:  cfg.Settings.BurstIdle,
+		Verify:     cfg.Settings.Verify,
+		TraceFile:  cfg.Settings.Trace,
+		ReplaySpeed: cfg.Settings.ReplaySpeed,
+		SyncMode:   cfg.Settings.SyncMode,
+		FsyncEvery: cfg.Settings.FsyncEvery,
+		Fdatasync:  cfg.Settings.Fdatasync,
+		CompressRatio: cfg.Settings.CompressRatio,
+		DedupePct:  cfg.Settings.DedupePct,
+		RefillEvery: cfg.Settings.RefillEvery,
+		FixedBufs:  cfg.Settings.FixedBufs,
+		FixedFiles: cfg.Settings.FixedFiles,
+		SQPoll:     cfg.Settings.SQPoll,
+		SQPollIdle: cfg.Settings.SQPollIdle,
+		IOPoll:     cfg.Settings.IOPoll,
+		SubmitBatch: cfg.Settings.SubmitBatch,
+		CompleteBatch: cfg.Settings.CompleteBatch,
+		Sim:        cfg.Settings.Sim,
+		CPUs:       cfg.Settings.CPUs,
+		SeriesInterval: cfg.Settings.SeriesInterval,
+		RampTime:   cfg.Settings.RampTime,
 		MinRuntime: *durFlag,
 		MaxRuntime: *durFlag,
 	}
@@ -86,14 +121,16 @@ func runSustainCmd() {
 		fmt.Printf("\rElapsed: %v | IOPS: %.0f | Conf: %.4f", r.Duration.Round(time.Second), r.IOPS, r.MetricConfidence)
 	}
 
-	eng := engine.New(params.EngineType)
-	res, err := eng.Run(params)
+	eng := newEngine(params.EngineType)
+	ctx := signalContext()
+	res, err := eng.Run(ctx, params)
 	
 	fmt.Println() // Newline after progress
 	
 	close(traceCh) // Signal analyzer to finish
 	
-	if err != nil {
+	// An interrupted run still has a profile up to the interrupt.
+	if err != nil && ctx.Err() == nil {
 		fmt.Printf("Run failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -114,6 +151,12 @@ func runSustainCmd() {
 	}
 	fmt.Printf("Stability profile written to %s\n", *outFlag)
 	fmt.Printf("Average IOPS: %.0f\n", res.IOPS)
+	if params.Verify != "" {
+		fmt.Printf("Verified Blocks: %d, Failures: %d\n", res.VerifiedBlocks, res.VerifyFailures)
+		for _, ve := range res.VerifyErrors {
+			fmt.Printf("  offset %d: %s\n", ve.Offset, ve.Reason)
+		}
+	}
 
 	if len(finalPoints) > 2 {
 		linear := analyze.FindDominantSlope(finalPoints, *tolFlag)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/runningwild/jolt/pkg/engine"
 )
@@ -14,11 +15,15 @@ type Server struct {
 	path string
 }
 
-func NewServer(engType string, path string) *Server {
+func NewServer(engType string, path string) (*Server, error) {
+	eng, err := engine.New(engType)
+	if err != nil {
+		return nil, err
+	}
 	return &Server{
-		eng:  engine.New(engType),
+		eng:  eng,
 		path: path,
-	}
+	}, nil
 }
 
 func (s *Server) VerifyAccess() error {
@@ -46,7 +51,7 @@ func (s *Server) ListenAndServe(port int) error {
 	http.HandleFunc("/health", s.handleHealth)
 	
 	addr := fmt.Sprintf(":%d", port)
-	fmt.Printf("Jolt Agent listening on %s (Engine: default)\n", addr)
+	fmt.Printf("Jolt Agent listening on %s (Engines: %s)\n", addr, strings.Join(engine.Names(), ", "))
 	return http.ListenAndServe(addr, nil)
 }
 
@@ -83,9 +88,14 @@ func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
 	// internally or relies on the struct.
 	
 	// Let's create a fresh engine for the request to be safe and stateless.
-	eng := engine.New(params.EngineType)
-	
-	res, err := eng.Run(params)
+	eng, err := engine.New(params.EngineType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The run stops if the controller goes away.
+	res, err := eng.Run(r.Context(), params)
 	if err != nil {
 		fmt.Printf("Error running engine: %v\n", err)
 		// If the test failed (e.g. disk error), we return 200 OK but with error in JSON?
@@ -0,0 +1,51 @@
+package analyze
+
+import "math"
+
+// SNIA PTS steady-state limits: within the measurement window, the data
+// excursion (max - min) must stay within 20% of the window average, and the
+// excursion of the best-fit line within 10%.
+const (
+	SteadyRangeLimit = 0.20
+	SteadySlopeLimit = 0.10
+)
+
+// SteadyStateResult describes the last window of a round-by-round metric.
+type SteadyStateResult struct {
+	Steady  bool
+	Average float64
+	Range   float64 // (max - min) / Average
+	Slope   float64 // |slope| * (window - 1) / Average
+	Start   int     // Index of the first round in the window
+}
+
+// SteadyState checks whether the last window values satisfy the SNIA PTS
+// steady-state criteria. It never reports steady state with fewer than
+// window values.
+func SteadyState(values []float64, window int) SteadyStateResult {
+	if window < 2 || len(values) < window {
+		return SteadyStateResult{Start: -1}
+	}
+	start := len(values) - window
+	w := values[start:]
+
+	points := make([]Point, len(w))
+	minV, maxV, sum := math.Inf(1), math.Inf(-1), 0.0
+	for i, v := range w {
+		points[i] = Point{X: float64(start + i), Y: v}
+		minV = math.Min(minV, v)
+		maxV = math.Max(maxV, v)
+		sum += v
+	}
+	avg := sum / float64(len(w))
+	res := SteadyStateResult{Average: avg, Start: start}
+	if avg <= 0 {
+		return res
+	}
+
+	m, _ := leastSquares(points)
+	res.Range = (maxV - minV) / avg
+	res.Slope = math.Abs(m) * float64(window-1) / avg
+	res.Steady = res.Range <= SteadyRangeLimit && res.Slope <= SteadySlopeLimit
+	return res
+}
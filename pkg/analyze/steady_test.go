@@ -0,0 +1,25 @@
+package analyze
+
+import (
+	"testing"
+)
+
+func TestSteadyState(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		steady bool
+	}{
+		{"Too Few Rounds", []float64{100, 100, 100}, false},
+		{"Flat", []float64{300, 200, 100, 101, 99, 100, 102}, true},
+		{"Still Falling", []float64{200, 180, 160, 140, 120}, false},
+		{"Noisy", []float64{100, 125, 95, 100, 100}, false},
+		{"Gentle Drift", []float64{100, 101, 102, 103, 104}, true},
+	}
+	for _, tt := range tests {
+		got := SteadyState(tt.values, 5)
+		if got.Steady != tt.steady {
+			t.Errorf("%s: Steady = %v, want %v (range %.3f, slope %.3f)", tt.name, got.Steady, tt.steady, got.Range, got.Slope)
+		}
+	}
+}
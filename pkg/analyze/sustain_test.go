@@ -0,0 +1,57 @@
+package analyze
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+// A simulated drive falls off its write cache cliff partway through, so the
+// rate it sustains for a short while is well above what it sustains for the
+// whole run.
+func TestSustainAnalyzerSimCliff(t *testing.T) {
+	params := engine.Params{
+		EngineType: "sim",
+		BlockSize:  4096,
+		ReadPct:    0,
+		Workers:    4,
+		QueueDepth: 32,
+		MinRuntime: 3 * time.Second,
+		MaxRuntime: 3 * time.Second,
+		Sim:        &engine.SimDevice{WriteCache: 1 << 30},
+	}
+	ch := make(chan engine.TraceMsg, 64)
+	params.TraceChannel = ch
+	a := NewSustainAnalyzer(ch, params.Workers)
+	done := make(chan struct{})
+	go func() {
+		a.Run()
+		close(done)
+	}()
+
+	res, err := engine.NewSim().Run(context.Background(), params)
+	close(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	sustained := func(secs float64) float64 {
+		for _, p := range a.GetProfile() {
+			if p.X >= secs {
+				return p.Y
+			}
+		}
+		return 0
+	}
+	short, long := sustained(0.2), sustained(2.5)
+	t.Logf("overall %.0f IOPS; sustained for 0.2s: %.0f, for 2.5s: %.0f", res.IOPS, short, long)
+	if short < 2*long {
+		t.Errorf("cliff not visible: %.0f IOPS for 0.2s vs %.0f for 2.5s", short, long)
+	}
+	if long <= 0 || long > res.IOPS {
+		t.Errorf("rate sustained for 2.5s (%.0f) should be positive and below the average (%.0f)", long, res.IOPS)
+	}
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -16,7 +17,7 @@ import (
 )
 
 type RemoteNode interface {
-	Run(params engine.Params) (*engine.Result, error)
+	Run(ctx context.Context, params engine.Params) (*engine.Result, error)
 	Name() string
 }
 
@@ -41,77 +42,202 @@ func New(joltNodes []string, fioNodes []string) *ClusterEngine {
 
 func (c *ClusterEngine) NumNodes() int { return len(c.nodes) }
 
-func (c *ClusterEngine) Run(params engine.Params) (*engine.Result, error) {
+// Run runs params on all nodes at once and combines their results. Unlike
+// the local engines it returns no result if ctx is cancelled.
+func (c *ClusterEngine) Run(ctx context.Context, params engine.Params) (*engine.Result, error) {
+	nodeParams, err := c.split(params)
+	if err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 	results := make([]*engine.Result, len(c.nodes))
 	errors := make([]error, len(c.nodes))
 
 	// Fan out
 	for i, node := range c.nodes {
+		if nodeParams[i] == nil {
+			continue
+		}
 		wg.Add(1)
-		
+		go func(idx int, n RemoteNode, p engine.Params) {
+			defer wg.Done()
+			res, err := n.Run(ctx, p)
+			results[idx] = res
+			errors[idx] = err
+		}(i, node, *nodeParams[i])
+	}
+	wg.Wait()
+
+	// Cancelling ctx aborts the requests to the nodes, so there is no
+	// partial result to return.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Check errors
+	for i, err := range errors {
+		if err != nil {
+			return nil, fmt.Errorf("node %s failed: %v", c.nodes[i].Name(), err)
+		}
+	}
+
+	res, err := c.aggregate(results)
+	if err != nil {
+		return nil, err
+	}
+	res.NodeDevices = c.nodeDevices(results)
+	return res, nil
+}
+
+// split returns the params of each node, or nil for nodes left idle. The
+// workload is divided among the nodes: Workers and QueueDepth evenly, and
+// the open-loop rate and I/O count in proportion to each node's workers, so
+// that the nodes together run what params asks for. Groups are split the
+// same way.
+func (c *ClusterEngine) split(params engine.Params) ([]*engine.Params, error) {
+	nodeParams := make([]*engine.Params, len(c.nodes))
+	var active []int
+	var workers []int
+	for i := range c.nodes {
 		// Calculate per-node params
-		nodeParams := params
-		
+		p := params
+
 		// Always distribute Workers
 		baseW := params.Workers / len(c.nodes)
 		remW := params.Workers % len(c.nodes)
 		if i < remW {
-			nodeParams.Workers = baseW + 1
+			p.Workers = baseW + 1
 		} else {
-			nodeParams.Workers = baseW
+			p.Workers = baseW
 		}
-		
+
 		// Distribute QueueDepth only if explicitly set (> 0)
 		if params.QueueDepth > 0 {
 			baseQD := params.QueueDepth / len(c.nodes)
 			remQD := params.QueueDepth % len(c.nodes)
 			if i < remQD {
-				nodeParams.QueueDepth = baseQD + 1
+				p.QueueDepth = baseQD + 1
 			} else {
-				nodeParams.QueueDepth = baseQD
+				p.QueueDepth = baseQD
 			}
 
-			if nodeParams.QueueDepth == 0 {
-				wg.Done() // Skip
-				continue
+			if p.QueueDepth == 0 {
+				continue // Skip
 			}
 		}
 
-		if nodeParams.Workers == 0 {
-			wg.Done() // Skip
-			continue
+		if p.Workers == 0 {
+			continue // Skip
 		}
+		nodeParams[i] = &p
+		active = append(active, i)
+		workers = append(workers, p.Workers)
+	}
 
-		go func(idx int, n RemoteNode, p engine.Params) {
-			defer wg.Done()
-			res, err := n.Run(p)
-			results[idx] = res
-			errors[idx] = err
-		}(i, node, nodeParams)
+	for j, i := range active {
+		p := nodeParams[i]
+		p.TargetIOPS = params.TargetIOPS * float64(workers[j]) / float64(sum(workers))
+		p.StopIOs = share(params.StopIOs, workers, j)
+
+		if len(params.Groups) > 0 {
+			p.Groups = make([]engine.Group, len(params.Groups))
+		}
+		for k, g := range params.Groups {
+			// A group without its own workers uses the node's.
+			groupWorkers := workers
+			if g.Workers > 0 {
+				groupWorkers = evenly(g.Workers, len(active))
+				if groupWorkers[j] == 0 {
+					return nil, fmt.Errorf("group %q has %d workers for %d nodes", g.Name, g.Workers, len(active))
+				}
+				g.Workers = groupWorkers[j]
+			}
+			g.TargetIOPS = g.TargetIOPS * float64(groupWorkers[j]) / float64(sum(groupWorkers))
+			p.Groups[k] = g
+		}
 	}
-	wg.Wait()
+	return nodeParams, nil
+}
 
-	// Check errors
-	for i, err := range errors {
-		if err != nil {
-			return nil, fmt.Errorf("node %s failed: %v", c.nodes[i].Name(), err)
+// evenly splits total into n parts that differ by at most one.
+func evenly(total, n int) []int {
+	parts := make([]int, n)
+	for i := range parts {
+		parts[i] = total / n
+		if i < total%n {
+			parts[i]++
 		}
 	}
+	return parts
+}
+
+// share returns part j of total split in proportion to weights. The parts
+// add up to total.
+func share(total int64, weights []int, j int) int64 {
+	before := sum(weights[:j])
+	all := int64(sum(weights))
+	return total*int64(before+weights[j])/all - total*int64(before)/all
+}
+
+func sum(xs []int) int {
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
 
-	return c.aggregate(results), nil
+// nodeDevices returns the device statistics of each node. The nodes drive
+// different devices, so they aren't added up into Result.Device.
+func (c *ClusterEngine) nodeDevices(results []*engine.Result) map[string]*engine.DeviceStats {
+	var devs map[string]*engine.DeviceStats
+	for i, r := range results {
+		if r == nil || r.Device == nil {
+			continue
+		}
+		if devs == nil {
+			devs = make(map[string]*engine.DeviceStats)
+		}
+		devs[c.nodes[i].Name()] = r.Device
+	}
+	return devs
 }
 
-func (c *ClusterEngine) aggregate(results []*engine.Result) *engine.Result {
+func (c *ClusterEngine) aggregate(results []*engine.Result) (*engine.Result, error) {
 	agg := &engine.Result{}
-	var totalWeight float64
+	var user, sys, wall time.Duration
+	var systemPct float64
+	var cpuNodes int
 
 	for _, r := range results {
 		if r == nil { continue }
 		
 		agg.TotalIOs += r.TotalIOs
+		agg.Bytes += r.Bytes
 		agg.IOPS += r.IOPS
 		agg.Throughput += r.Throughput
+		agg.OfferedIOPS += r.OfferedIOPS
+		agg.Read.TotalIOs += r.Read.TotalIOs
+		agg.Read.Bytes += r.Read.Bytes
+		agg.Read.IOPS += r.Read.IOPS
+		agg.Read.Throughput += r.Read.Throughput
+		agg.Write.TotalIOs += r.Write.TotalIOs
+		agg.Write.Bytes += r.Write.Bytes
+		agg.Write.IOPS += r.Write.IOPS
+		agg.Write.Throughput += r.Write.Throughput
+		agg.Flush.TotalIOs += r.Flush.TotalIOs
+		agg.Flush.IOPS += r.Flush.IOPS
+		agg.Discard.TotalIOs += r.Discard.TotalIOs
+		agg.Discard.Bytes += r.Discard.Bytes
+		agg.Discard.IOPS += r.Discard.IOPS
+		agg.Discard.Throughput += r.Discard.Throughput
+		agg.WriteZeroes.TotalIOs += r.WriteZeroes.TotalIOs
+		agg.WriteZeroes.Bytes += r.WriteZeroes.Bytes
+		agg.WriteZeroes.IOPS += r.WriteZeroes.IOPS
+		agg.WriteZeroes.Throughput += r.WriteZeroes.Throughput
+		agg.Slat.TotalIOs += r.Slat.TotalIOs
+		agg.Clat.TotalIOs += r.Clat.TotalIOs
 		
 		if r.Duration > agg.Duration {
 			agg.Duration = r.Duration
@@ -121,25 +247,49 @@ func (c *ClusterEngine) aggregate(results []*engine.Result) *engine.Result {
 		}
 		agg.TerminationReason = r.TerminationReason
 
-		weight := float64(r.TotalIOs)
-		totalWeight += weight
-		
-		agg.MeanLatency += time.Duration(float64(r.MeanLatency) * weight)
-		agg.P50Latency += time.Duration(float64(r.P50Latency) * weight)
-		agg.P95Latency += time.Duration(float64(r.P95Latency) * weight)
-		agg.P99Latency += time.Duration(float64(r.P99Latency) * weight)
-		agg.P999Latency += time.Duration(float64(r.P999Latency) * weight)
+		// The nodes run at once on separate machines: their CPU time adds
+		// up over a shared window.
+		if r.CPU.Wall > 0 {
+			user += r.CPU.User
+			sys += r.CPU.Sys
+			wall = max(wall, r.CPU.Wall)
+			systemPct += r.CPU.SystemPct
+			cpuNodes++
+		}
+	}
+	if cpuNodes > 0 {
+		agg.CPU = engine.NewCPUStats(user, sys, wall, systemPct/float64(cpuNodes), agg.TotalIOs)
+	}
+	agg.Series = engine.MergeSeries(results...)
+
+	// Combine the per-node latency distributions so cluster-wide percentiles
+	// are exact rather than an average of per-node percentiles.
+	if err := engine.MergeLatency(agg, results...); err != nil {
+		return nil, err
 	}
+	engine.MergeVerify(agg, results...)
 
-	if totalWeight > 0 {
-		agg.MeanLatency = time.Duration(float64(agg.MeanLatency) / totalWeight)
-		agg.P50Latency = time.Duration(float64(agg.P50Latency) / totalWeight)
-		agg.P95Latency = time.Duration(float64(agg.P95Latency) / totalWeight)
-		agg.P99Latency = time.Duration(float64(agg.P99Latency) / totalWeight)
-		agg.P999Latency = time.Duration(float64(agg.P999Latency) / totalWeight)
+	// With Params.Groups every node ran all the groups: combine them group
+	// by group.
+	groups := make(map[string][]*engine.Result)
+	for _, r := range results {
+		if r == nil { continue }
+		for name, g := range r.Groups {
+			groups[name] = append(groups[name], g)
+		}
+	}
+	for name, rs := range groups {
+		g, err := c.aggregate(rs)
+		if err != nil {
+			return nil, err
+		}
+		if agg.Groups == nil {
+			agg.Groups = make(map[string]*engine.Result)
+		}
+		agg.Groups[name] = g
 	}
 
-	return agg
+	return agg, nil
 }
 
 // --- Jolt Agent Node ---
@@ -150,7 +300,7 @@ type JoltAgentNode struct {
 
 func (n *JoltAgentNode) Name() string { return n.host }
 
-func (n *JoltAgentNode) Run(params engine.Params) (*engine.Result, error) {
+func (n *JoltAgentNode) Run(ctx context.Context, params engine.Params) (*engine.Result, error) {
 	url := fmt.Sprintf("http://%s/run", n.host)
 	
 	data, err := json.Marshal(params)
@@ -158,13 +308,18 @@ func (n *JoltAgentNode) Run(params engine.Params) (*engine.Result, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	timeout := params.MaxRuntime + 5*time.Second
+	// The ramp comes before MaxRuntime, and a verify read-back pass after it.
+	// Reading back what the run wrote takes about as long as writing it.
+	timeout := params.RampTime + params.MaxRuntime + 5*time.Second
+	if params.Verify == "pass" {
+		timeout += params.MaxRuntime
+	}
 	if timeout < 10*time.Second { timeout = 10 * time.Second }
 	client := &http.Client{Timeout: timeout}
 
@@ -194,7 +349,7 @@ type FioServerNode struct {
 
 func (n *FioServerNode) Name() string { return "fio@" + n.host }
 
-func (n *FioServerNode) Run(params engine.Params) (*engine.Result, error) {
+func (n *FioServerNode) Run(ctx context.Context, params engine.Params) (*engine.Result, error) {
 	jobContent := fio.GenerateJob(params)
 	
 	tmpFile, err := os.CreateTemp("", "jolt_fio_*.fio")
@@ -211,7 +366,7 @@ func (n *FioServerNode) Run(params engine.Params) (*engine.Result, error) {
 
 	// Run FIO
 	// Requires 'fio' binary in PATH
-	cmd := exec.Command("fio", fmt.Sprintf("--client=%s", n.host), "--output-format=json", jobPath)
+	cmd := exec.CommandContext(ctx, "fio", fmt.Sprintf("--client=%s", n.host), "--output-format=json+", jobPath)
 	out, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+// localNode runs params on an engine in-process.
+type localNode struct {
+	name string
+	eng  engine.Engine
+}
+
+func (n *localNode) Name() string { return n.name }
+
+func (n *localNode) Run(ctx context.Context, params engine.Params) (*engine.Result, error) {
+	return n.eng.Run(ctx, params)
+}
+
+func TestClusterSplitsOfferedLoad(t *testing.T) {
+	c := &ClusterEngine{}
+	for _, name := range []string{"a", "b", "c"} {
+		c.nodes = append(c.nodes, &localNode{name, engine.NewSim()})
+	}
+	params := engine.Params{
+		EngineType: "sim",
+		BlockSize:  4096,
+		ReadPct:    100,
+		Rand:       true,
+		Workers:    4, // Split 2/1/1
+		QueueDepth: 8,
+		TargetIOPS: 6000,
+		MinRuntime: time.Second,
+		MaxRuntime: time.Second,
+	}
+	res, err := c.Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OfferedIOPS < 5700 || res.OfferedIOPS > 6300 {
+		t.Errorf("offered %.0f IOPS, want ~6000", res.OfferedIOPS)
+	}
+}
+
+func TestClusterSplit(t *testing.T) {
+	c := &ClusterEngine{nodes: []RemoteNode{&localNode{name: "a"}, &localNode{name: "b"}, &localNode{name: "c"}}}
+	params := engine.Params{
+		Workers:    4,
+		TargetIOPS: 1000,
+		StopIOs:    1001,
+		Groups: []engine.Group{
+			{Name: "probe"},
+			{Name: "load", Workers: 6, TargetIOPS: 600},
+		},
+	}
+	ps, err := c.split(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var iops, loadIOPS float64
+	var ios int64
+	var loadWorkers int
+	for _, p := range ps {
+		iops += p.TargetIOPS
+		ios += p.StopIOs
+		loadWorkers += p.Groups[1].Workers
+		loadIOPS += p.Groups[1].TargetIOPS
+		if p.Groups[0].Workers != 0 || p.Groups[0].TargetIOPS != 0 {
+			t.Errorf("probe group changed: %+v", p.Groups[0])
+		}
+	}
+	if iops != 1000 || ios != 1001 || ps[0].TargetIOPS != 500 {
+		t.Errorf("split into %.0f IOPS, %d I/Os; node a got %.0f IOPS", iops, ios, ps[0].TargetIOPS)
+	}
+	if loadWorkers != 6 || loadIOPS != 600 {
+		t.Errorf("load group split into %d workers, %.0f IOPS", loadWorkers, loadIOPS)
+	}
+	if params.Groups[1].Workers != 6 {
+		t.Errorf("split modified params")
+	}
+
+	params.Groups[1].Workers = 2
+	if _, err := c.split(params); err == nil {
+		t.Errorf("group with fewer workers than nodes accepted")
+	}
+}
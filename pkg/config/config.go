@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/runningwild/jolt/pkg/engine"
 )
 
 // Config represents the top-level configuration for an optimization run.
@@ -17,19 +19,82 @@ type Config struct {
 }
 
 type Settings struct {
-	EngineType       string        `yaml:"engine_type"` // "sync" or "uring"
+	EngineType       string        `yaml:"engine_type"` // "sync", "uring", "libaio", "replay" or "sim"
 	Direct           bool          `yaml:"direct"`
 	ReadPct          int           `yaml:"read_pct"` // 0-100
+	DiscardPct       int           `yaml:"discard_pct,omitempty"`      // % of all ops that are discards (TRIM); read_pct splits the rest
+	WriteZeroesPct   int           `yaml:"write_zeroes_pct,omitempty"` // % of all ops that are write-zeroes
 	Write_Deprecated bool          `yaml:"write"`    // Deprecated: use read_pct
 	Rand             bool          `yaml:"rand"`
+	Distribution     string        `yaml:"distribution,omitempty"` // e.g. "zipf:1.2", "zoned:80/10:20/90"
+	BSSplit          string        `yaml:"bssplit,omitempty"`      // e.g. "4k/60:64k/30:1m/10" or "<reads>,<writes>"; overrides block_size
+	Offset           int64         `yaml:"offset,omitempty"`       // Start of the I/O region in bytes
+	Length           int64         `yaml:"length,omitempty"`       // Size of the I/O region in bytes; 0 = to the end
+	WorkingSet       int64         `yaml:"working_set,omitempty"`  // Bytes of the region actually touched; 0 = all
+	Disjoint         bool          `yaml:"disjoint,omitempty"`     // Split the region between workers
+	TargetIOPS       float64       `yaml:"target_iops,omitempty"` // Open-loop arrival rate; 0 = closed loop
+	Arrival          string        `yaml:"arrival,omitempty"`     // "fixed" (default) or "poisson"
+	SpinWait         bool          `yaml:"spin_wait,omitempty"`   // Spin before scheduled I/Os for precise timing, at a CPU cost
+	ThinkTime        time.Duration `yaml:"think_time,omitempty"`  // Pause of each worker between its I/Os
+	ThinkDist        string        `yaml:"think_dist,omitempty"`  // "fixed" (default) or "exp" (exponential around think_time)
+	BurstIOs         int           `yaml:"burst_ios,omitempty"`   // I/Os per worker burst, followed by burst_idle; 0 = no bursts
+	BurstIdle        time.Duration `yaml:"burst_idle,omitempty"`  // Idle time after each burst has completed
+	Trace            string        `yaml:"trace,omitempty"`        // I/O trace for the replay engine (CSV or blkparse text)
+	ReplaySpeed      float64       `yaml:"replay_speed,omitempty"` // 0 = as fast as possible, 1 = original timing, 2 = twice as fast
+	Verify           string        `yaml:"verify,omitempty"`      // "inline" or "pass"; empty disables data verification
+	SyncMode         string        `yaml:"sync_mode,omitempty"`      // "dsync" or "sync" opens the target with O_DSYNC/O_SYNC
+	FsyncEvery       int           `yaml:"fsync_every,omitempty"`    // Flush after every N writes per worker; 0 = never
+	Fdatasync        bool          `yaml:"fdatasync,omitempty"`      // Flush with fdatasync instead of fsync
+	CompressRatio    float64       `yaml:"compress_ratio,omitempty"` // Random write data compressible this much (2 = 2:1, 1 = not at all)
+	DedupePct        int           `yaml:"dedupe_pct,omitempty"`     // Percentage of written 4KiB blocks that are duplicates
+	RefillEvery      int           `yaml:"refill_every,omitempty"`   // Regenerate write data every N writes; 0 = every write
+	FixedBufs        bool          `yaml:"fixed_bufs,omitempty"`     // io_uring: registered buffers
+	FixedFiles       bool          `yaml:"fixed_files,omitempty"`    // io_uring: registered files
+	SQPoll           bool          `yaml:"sqpoll,omitempty"`         // io_uring: kernel SQ polling thread
+	SQPollIdle       time.Duration `yaml:"sqpoll_idle,omitempty"`    // io_uring: SQ thread idle time before sleeping
+	IOPoll           bool          `yaml:"iopoll,omitempty"`         // io_uring: poll for completions (needs direct)
+	SubmitBatch      int           `yaml:"submit_batch,omitempty"`   // io_uring: SQEs per submit
+	CompleteBatch    int           `yaml:"complete_batch,omitempty"` // io_uring: completions to wait for at once
+	Sim              *engine.SimDevice `yaml:"sim,omitempty"`   // Device model for the "sim" engine
+	CPUs             string        `yaml:"cpus,omitempty"`      // Pin workers: a CPU list ("0-3,8"), "node:N" or "local" (the target's NUMA node)
+	RampTime         time.Duration `yaml:"ramp_time,omitempty"` // Warm-up per test point, excluded from measurement
 	MinRuntime       time.Duration `yaml:"min_runtime"`
 	MaxRuntime       time.Duration `yaml:"max_runtime"`
 	ErrorTarget      float64       `yaml:"error_target"`
+	StopRule         string        `yaml:"stop_rule,omitempty"` // stderr (default), batch_means, p99_ci, plateau or io_count
+	StopIOs          int64         `yaml:"stop_ios,omitempty"`  // I/Os per test point for the io_count rule
+	SeriesInterval   time.Duration `yaml:"series_interval,omitempty"` // Record a per-interval time series in each result; 0 = off
+
+	// If set, the workloads run at once, each with the settings above
+	// overridden by its own. Objectives can target one group's metrics as
+	// "<group>.<metric>".
+	Groups []engine.Group `yaml:"groups,omitempty"`
+
+	// If set, the target is preconditioned to steady state before testing.
+	Precondition *Precondition `yaml:"precondition,omitempty"`
+}
+
+// Precondition describes how to bring a drive to steady state: a sequential
+// fill of the I/O region, then rounds of random writes until the SNIA PTS
+// steady-state criteria hold for the IOPS of the last Window rounds.
+// Zero values use the defaults noted below.
+type Precondition struct {
+	SkipFill      bool          `yaml:"skip_fill,omitempty"`
+	FillBlockSize int           `yaml:"fill_block_size,omitempty"` // Default 128KiB
+	BlockSize     int           `yaml:"block_size,omitempty"`      // Random write size; default 4096
+	Workers       int           `yaml:"workers,omitempty"`         // Default 4
+	QueueDepth    int           `yaml:"queue_depth,omitempty"`     // Default 32
+	RoundTime     time.Duration `yaml:"round_time,omitempty"`      // Default 1m
+	Window        int           `yaml:"window,omitempty"`          // Default 5
+	MaxRounds     int           `yaml:"max_rounds,omitempty"`      // Default 25
 }
 
 // Variable defines a parameter to optimize.
 type Variable struct {
-	Name   string    `yaml:"variable"` // "block_size", "queue_depth", "workers"
+	// "block_size", "queue_depth", "workers", "target_iops", "discard_pct", or one of the
+	// io_uring knobs: "fixed_bufs", "fixed_files", "sqpoll", "iopoll" (0 or
+	// 1), "sqpoll_idle" (ms), "submit_batch", "complete_batch"
+	Name   string    `yaml:"variable"`
 	Values []int     `yaml:"values,omitempty"` // Explicit list (e.g. for block_size)
 	Range  []int     `yaml:"range,omitempty"`  // [min, max] (e.g. for workers)
 	Step   int       `yaml:"step,omitempty"`   // Step size for range
@@ -38,7 +103,7 @@ type Variable struct {
 // Objective defines what to maximize/minimize or constrain.
 type Objective struct {
 	Type   string  `yaml:"type"`   // "maximize", "minimize", "constraint"
-	Metric string  `yaml:"metric"` // "iops", "throughput", "p99_latency", "p50_latency"
+	Metric string  `yaml:"metric"` // "iops", "throughput", "p99_latency", "p50_latency"; prefix "read_"/"write_" for one direction, "flush_"/"discard_"/"write_zeroes_" for those ops, "slat_"/"clat_" for submission/completion latency, "<group>." for one of settings.groups; or "cpu_per_io" (µs, minimize) / "iops_per_core" (maximize), for the whole run and not as constraints
 	Limit  string  `yaml:"limit,omitempty"` // For constraints: "10ms", "50000"
 }
 
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Mixed block sizes, selected by Params.BSSplit using fio's bssplit syntax:
+//
+//	4k/60:64k/30:1m/10              the same mix for reads and writes
+//	4k/60:64k/40,128k/100           reads, then writes
+//
+// Weights are percentages and must sum to 100 for each direction. Every size
+// must be a multiple of the smallest one, which is also the offset alignment.
+type blockSizes struct {
+	read  []bsEntry
+	write []bsEntry
+	min   int
+	max   int
+	align int // Offset granularity
+}
+
+type bsEntry struct {
+	size   int
+	weight float64
+}
+
+// newBlockSizes resolves the block sizes of params. Without a BSSplit every
+// I/O is Params.BlockSize.
+func newBlockSizes(params Params) (blockSizes, error) {
+	if params.BSSplit == "" {
+		if params.BlockSize <= 0 {
+			return blockSizes{}, fmt.Errorf("invalid block size: %d", params.BlockSize)
+		}
+		one := []bsEntry{{size: params.BlockSize, weight: 100}}
+		return blockSizes{read: one, write: one, min: params.BlockSize, max: params.BlockSize, align: params.BlockSize}, nil
+	}
+
+	readSpec, writeSpec, ok := strings.Cut(params.BSSplit, ",")
+	if !ok {
+		writeSpec = readSpec
+	}
+	var b blockSizes
+	var err error
+	if b.read, err = parseBSSplit(readSpec); err != nil {
+		return b, err
+	}
+	if b.write, err = parseBSSplit(writeSpec); err != nil {
+		return b, err
+	}
+
+	b.min, b.max = math.MaxInt, 0
+	for _, e := range append(append([]bsEntry(nil), b.read...), b.write...) {
+		b.min = min(b.min, e.size)
+		b.max = max(b.max, e.size)
+	}
+	for _, e := range append(append([]bsEntry(nil), b.read...), b.write...) {
+		if e.size%b.min != 0 {
+			return b, fmt.Errorf("bssplit size %d is not a multiple of the smallest size %d", e.size, b.min)
+		}
+	}
+	b.align = b.min
+	if params.Verify != "" {
+		// Verification tracks blocks by their offset, which only works if
+		// I/Os of different sizes never start inside each other.
+		b.align = b.max
+	}
+	return b, nil
+}
+
+func parseBSSplit(spec string) ([]bsEntry, error) {
+	var entries []bsEntry
+	var sum float64
+	for _, part := range strings.Split(spec, ":") {
+		sizeStr, weightStr, ok := strings.Cut(part, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid bssplit entry %q (want <size>/<percent>)", part)
+		}
+		size, err := parseSize(sizeStr)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid bssplit size %q", sizeStr)
+		}
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid bssplit percentage %q", weightStr)
+		}
+		entries = append(entries, bsEntry{size: int(size), weight: weight})
+		sum += weight
+	}
+	if math.Abs(sum-100) > 1e-6 {
+		return nil, fmt.Errorf("bssplit percentages must sum to 100 (got %g)", sum)
+	}
+	return entries, nil
+}
+
+// parseSize parses a byte count with an optional binary suffix (k, m, g, t),
+// as fio does.
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "b"), "i")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k':
+			mult = 1 << 10
+		case 'm':
+			mult = 1 << 20
+		case 'g':
+			mult = 1 << 30
+		case 't':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * mult, nil
+}
+
+// pick returns the size of the next I/O.
+func (b *blockSizes) pick(isRead bool, r *rand.Rand) int {
+	entries := b.write
+	if isRead {
+		entries = b.read
+	}
+	if len(entries) == 1 {
+		return entries[0].size
+	}
+	u := r.Float64() * 100
+	var acc float64
+	for _, e := range entries {
+		acc += e.weight
+		if u < acc {
+			return e.size
+		}
+	}
+	return entries[len(entries)-1].size
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBlockSizes(t *testing.T) {
+	b, err := newBlockSizes(Params{BSSplit: "4k/60:64k/30:1m/10,8k/100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.min != 4096 || b.max != 1<<20 || b.align != 4096 {
+		t.Fatalf("got min=%d max=%d align=%d", b.min, b.max, b.align)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	counts := map[int]int{}
+	for i := 0; i < 10000; i++ {
+		counts[b.pick(true, r)]++
+		if n := b.pick(false, r); n != 8192 {
+			t.Fatalf("write size %d, want 8192", n)
+		}
+	}
+	if c := counts[4096]; c < 5700 || c > 6300 {
+		t.Errorf("4k picked %d/10000 times, want ~6000", c)
+	}
+
+	for _, spec := range []string{"4k/50", "4k:100", "3k/50:4k/50", "xk/100"} {
+		if _, err := newBlockSizes(Params{BSSplit: spec}); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestEngineRunBSSplit(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-bssplit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(4 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	params := Params{
+		EngineType: "sync",
+		Path:       tmpFile.Name(),
+		BSSplit:    "4k/50:64k/50",
+		ReadPct:    50,
+		Rand:       true,
+		Workers:    2,
+		MinRuntime: 100 * time.Millisecond,
+		MaxRuntime: 200 * time.Millisecond,
+		Verify:     "pass",
+	}
+	result, err := mustNew(t, "sync").Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// Half of the I/Os are 64k, so the average I/O is well above 4k.
+	avg := float64(result.Bytes) / float64(result.TotalIOs)
+	if avg < 20000 || avg > 50000 {
+		t.Errorf("average I/O size %.0f, want ~34k", avg)
+	}
+	if result.Read.Bytes+result.Write.Bytes != result.Bytes {
+		t.Errorf("direction bytes %d+%d != %d", result.Read.Bytes, result.Write.Bytes, result.Bytes)
+	}
+	if result.VerifyFailures != 0 {
+		t.Errorf("verify failures: %v", result.VerifyErrors)
+	}
+}
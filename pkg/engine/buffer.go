@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	// compressChunk is the granularity of CompressRatio: each chunk is part
+	// random, part zeros, so block-based compressors see the ratio.
+	compressChunk = 512
+	// dedupeBlock is the granularity of DedupePct, the usual block size of
+	// deduplicating arrays.
+	dedupeBlock = 4096
+	// dedupeBlocks is the number of distinct duplicate blocks. Their content
+	// depends only on their index, so workers and runs share them.
+	dedupeBlocks = 64
+)
+
+// checkData validates the written data options (Params.CompressRatio,
+// DedupePct and RefillEvery). Engines that don't write buffers they own pass
+// canFill=false.
+func checkData(params Params, engineType string, canFill bool) error {
+	if params.CompressRatio != 0 && params.CompressRatio < 1 {
+		return fmt.Errorf("invalid compression ratio %g (want at least 1)", params.CompressRatio)
+	}
+	if params.DedupePct < 0 || params.DedupePct > 100 {
+		return fmt.Errorf("invalid dedupe percentage: %d", params.DedupePct)
+	}
+	if params.RefillEvery < 0 {
+		return fmt.Errorf("invalid refill interval: %d", params.RefillEvery)
+	}
+	if params.CompressRatio == 0 && params.DedupePct == 0 {
+		if params.RefillEvery != 0 {
+			return fmt.Errorf("refill needs a compression ratio or dedupe percentage")
+		}
+		return nil
+	}
+	if !canFill {
+		return fmt.Errorf("compression and dedupe control are not supported by the %s engine", engineType)
+	}
+	if params.Verify != "" {
+		return fmt.Errorf("compression and dedupe control can't be combined with verify, which writes its own data")
+	}
+	return nil
+}
+
+// dataGen fills the write buffers of one worker. Each buffer slot is
+// regenerated every RefillEvery writes, and before the next write after a
+// read has overwritten it. A nil dataGen leaves buffers alone.
+type dataGen struct {
+	random int // Random bytes per compressChunk
+	dedupe int
+	refill int
+	r      *rand.Rand
+	uses   []int // Writes since each slot was generated
+	filled []int // Bytes of each slot holding generated data
+}
+
+func newDataGen(params Params, slots int, seed int64) *dataGen {
+	if params.CompressRatio == 0 && params.DedupePct == 0 {
+		return nil
+	}
+	ratio := math.Max(params.CompressRatio, 1)
+	return &dataGen{
+		random: int(math.Round(compressChunk / ratio)),
+		dedupe: params.DedupePct,
+		refill: max(params.RefillEvery, 1),
+		r:      rand.New(rand.NewSource(seed)),
+		uses:   make([]int, slots),
+		filled: make([]int, slots),
+	}
+}
+
+// prepare readies buf, the buffer of slot, for an I/O. Call it before the
+// I/O is timed.
+func (g *dataGen) prepare(buf []byte, slot int, isRead bool) {
+	if g == nil {
+		return
+	}
+	if isRead {
+		g.filled[slot] = 0
+		return
+	}
+	if g.uses[slot]%g.refill == 0 || len(buf) > g.filled[slot] {
+		g.generate(buf)
+		g.uses[slot] = 0
+		g.filled[slot] = len(buf)
+	}
+	g.uses[slot]++
+}
+
+func (g *dataGen) generate(buf []byte) {
+	for off := 0; off < len(buf); off += dedupeBlock {
+		seed := g.r.Uint64()
+		if g.dedupe > 0 && g.r.Intn(100) < g.dedupe {
+			seed = uint64(g.r.Intn(dedupeBlocks)+1) * 0x9e3779b97f4a7c15
+		}
+		blk := buf[off:min(off+dedupeBlock, len(buf))]
+		for c := 0; c < len(blk); c += compressChunk {
+			chunk := blk[c:min(c+compressChunk, len(blk))]
+			n := min(g.random, len(chunk))
+			fillPattern(chunk[:n], seed^uint64(c)*0xbf58476d1ce4e5b9)
+			clear(chunk[n:])
+		}
+	}
+}
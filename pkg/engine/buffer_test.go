@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// compressRatio returns how much flate shrinks buf.
+func compressRatio(t *testing.T, buf []byte) float64 {
+	var out bytes.Buffer
+	w, err := flate.NewWriter(&out, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(buf)
+	w.Close()
+	return float64(len(buf)) / float64(out.Len())
+}
+
+func TestDataGenCompress(t *testing.T) {
+	if newDataGen(Params{}, 1, 1) != nil {
+		t.Errorf("data generated without being asked for")
+	}
+	for _, ratio := range []float64{1, 2, 4} {
+		g := newDataGen(Params{CompressRatio: ratio}, 1, 1)
+		buf := make([]byte, 1<<20)
+		g.prepare(buf, 0, false)
+		got := compressRatio(t, buf)
+		if got < ratio*0.85 || got > ratio*1.15 {
+			t.Errorf("ratio %g compresses %.2f:1", ratio, got)
+		}
+	}
+}
+
+func TestDataGenDedupe(t *testing.T) {
+	g := newDataGen(Params{DedupePct: 50}, 1, 1)
+	buf := make([]byte, 4000*dedupeBlock)
+	g.prepare(buf, 0, false)
+	seen := map[string]bool{}
+	dups := 0
+	for off := 0; off < len(buf); off += dedupeBlock {
+		blk := string(buf[off : off+dedupeBlock])
+		if seen[blk] {
+			dups++
+		}
+		seen[blk] = true
+	}
+	// The first copy of each shared block isn't a duplicate.
+	if pct := 100 * float64(dups) / 4000; pct < 44 || pct > 52 {
+		t.Errorf("%.1f%% duplicate blocks, want about 48%%", pct)
+	}
+}
+
+func TestDataGenRefill(t *testing.T) {
+	g := newDataGen(Params{CompressRatio: 1, RefillEvery: 3}, 2, 1)
+	buf := make([]byte, 4096)
+	var prev []byte
+	changed := func() bool {
+		c := !bytes.Equal(buf, prev)
+		prev = append(prev[:0], buf...)
+		return c
+	}
+	for i, want := range []bool{true, false, false, true, false} {
+		g.prepare(buf, 0, false)
+		if changed() != want {
+			t.Errorf("write %d: regenerated %v, want %v", i, !want, want)
+		}
+	}
+	// A read overwrites the buffer, so the next write regenerates it.
+	g.prepare(buf, 0, true)
+	g.prepare(buf, 0, false)
+	if !changed() {
+		t.Errorf("write after a read reused the buffer")
+	}
+	// A write larger than what was generated regenerates it too.
+	g.prepare(buf[:512], 1, false)
+	g.prepare(buf, 1, false)
+	if !changed() {
+		t.Errorf("larger write reused a partly generated buffer")
+	}
+
+	for _, p := range []Params{
+		{CompressRatio: 0.5},
+		{DedupePct: 101},
+		{RefillEvery: 2},
+		{CompressRatio: 2, Verify: "inline"},
+	} {
+		if err := checkData(p, "sync", true); err == nil {
+			t.Errorf("%+v accepted", p)
+		}
+	}
+	if err := checkData(Params{DedupePct: 10}, "sim", false); err == nil {
+		t.Errorf("sim accepted dedupe control")
+	}
+}
+
+func TestEngineRunCompressedWrites(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	params := Params{
+		EngineType:    "sync",
+		Path:          tmpFile.Name(),
+		BlockSize:     4096,
+		ReadPct:       0,
+		Workers:       1,
+		MinRuntime:    200 * time.Millisecond,
+		MaxRuntime:    200 * time.Millisecond,
+		CompressRatio: 3,
+	}
+	res, err := mustNew(t, "sync").Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalIOs < 256 {
+		t.Skipf("only %d writes, the file wasn't covered", res.TotalIOs)
+	}
+	data, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := compressRatio(t, data); got < 2.5 || got > 3.5 {
+		t.Errorf("written data compresses %.2f:1, want about 3:1", got)
+	}
+}
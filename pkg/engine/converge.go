@@ -0,0 +1,412 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// A stopRule decides when a test point has converged. The controller calls
+// check once per monitor interval; it returns the current relative error
+// estimate, reported as Result.MetricConfidence, and whether the point may
+// stop. No rule stops a point before Params.MinRuntime.
+type stopRule interface {
+	check(c *controller) (relErr float64, done bool)
+}
+
+// stopRules are the rules selectable with Params.StopRule.
+var stopRules = map[string]func(Params) (stopRule, error){
+	// Standard error of the IOPS samples relative to their mean. The samples
+	// are autocorrelated, so this tends to stop too early.
+	"stderr": func(Params) (stopRule, error) { return stderrRule{}, nil },
+
+	// The same over the means of 10 batches of consecutive samples, which
+	// are close to independent once the batches are long enough.
+	"batch_means": func(Params) (stopRule, error) { return batchMeansRule{}, nil },
+
+	// Relative standard error of the P99 latency of 10-20 batches.
+	"p99_ci": func(Params) (stopRule, error) { return &p99Rule{batchTicks: 1}, nil },
+
+	// IOPS changes by at most ErrorTarget over the last half of the run,
+	// going by its least-squares slope.
+	"plateau": func(Params) (stopRule, error) { return plateauRule{}, nil },
+
+	// A fixed number of I/Os, Params.StopIOs.
+	"io_count": func(p Params) (stopRule, error) {
+		if p.StopIOs <= 0 {
+			return nil, fmt.Errorf("the io_count stop rule needs a positive I/O count")
+		}
+		return ioCountRule{n: p.StopIOs}, nil
+	},
+}
+
+// DefaultStopRule is used when Params.StopRule is empty.
+const DefaultStopRule = "stderr"
+
+// controller is the convergence check shared by the engines. Workers report
+// every measured I/O with record; the monitor loop calls tick every interval.
+type controller struct {
+	params   Params
+	ruleName string
+	rule     stopRule
+	ops      int64     // Measured I/Os, updated atomically by the workers
+	bytes    int64     // Their bytes, likewise
+	lat      *liveHist // Latencies, for rules and series that need them
+
+	lastOps     int64
+	lastElapsed time.Duration
+	samples     []float64 // IOPS per monitor interval
+	relErr      float64
+
+	// CPU counters at the start of the measurement window, which is the
+	// first tick: that leaves out worker setup and the ramp.
+	cpuFrom    cpuSample
+	cpuFromOps int64
+	cpuStarted bool
+
+	// Block device counters, from the same point; disk is nil if the target
+	// has no block device.
+	disk     *diskDev
+	diskFrom diskSample
+
+	// Time series, one point per Params.SeriesInterval, rounded up to the
+	// monitor interval.
+	series      []SeriesPoint
+	seriesAt    time.Duration // End of the last point
+	seriesOps   int64
+	seriesBytes int64
+	seriesLat   []int64 // Latency counts at seriesAt
+}
+
+func newController(params Params) (*controller, error) {
+	name := params.StopRule
+	if name == "" {
+		name = DefaultStopRule
+	}
+	newRule, ok := stopRules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown stop rule %q (want stderr, batch_means, p99_ci, plateau or io_count)", name)
+	}
+	rule, err := newRule(params)
+	if err != nil {
+		return nil, err
+	}
+	c := &controller{params: params, ruleName: name, rule: rule, cpuFrom: takeCPUSample()}
+	if c.disk = findDiskDev(params.Path); c.disk != nil {
+		c.diskFrom = c.disk.sample()
+	}
+	if _, ok := rule.(*p99Rule); ok || params.SeriesInterval > 0 {
+		c.lat = &liveHist{}
+		c.seriesLat = make([]int64, liveBuckets)
+	}
+	return c, nil
+}
+
+// record counts one measured I/O that took us µs and moved n bytes. It is
+// safe for concurrent use.
+func (c *controller) record(us, n int64) {
+	atomic.AddInt64(&c.ops, 1)
+	atomic.AddInt64(&c.bytes, n)
+	if c.lat != nil {
+		c.lat.record(us)
+	}
+}
+
+// tick samples the I/Os done by elapsed, the time since the ramp ended, and
+// returns why the point should stop, or "" to keep going.
+func (c *controller) tick(elapsed time.Duration) string {
+	ops := atomic.LoadInt64(&c.ops)
+	if !c.cpuStarted {
+		c.cpuFrom = takeCPUSample()
+		c.cpuFromOps = ops
+		c.cpuStarted = true
+		if c.disk != nil {
+			c.diskFrom = c.disk.sample()
+		}
+	}
+	if dt := (elapsed - c.lastElapsed).Seconds(); dt > 0 {
+		c.samples = append(c.samples, float64(ops-c.lastOps)/dt)
+	}
+	c.lastOps = ops
+	c.lastElapsed = elapsed
+	if c.params.SeriesInterval > 0 && elapsed-c.seriesAt >= c.params.SeriesInterval {
+		c.addPoint(elapsed, ops)
+	}
+
+	relErr, done := c.rule.check(c)
+	c.relErr = relErr
+
+	if c.params.Progress != nil {
+		c.params.Progress(Result{
+			IOPS:             c.instantIOPS(),
+			MetricConfidence: relErr,
+			Duration:         elapsed,
+			TotalIOs:         ops,
+		})
+	}
+
+	if done && elapsed > c.params.MinRuntime {
+		return "Converged (" + c.ruleName + ")"
+	}
+	if c.params.MaxRuntime > 0 && elapsed >= c.params.MaxRuntime {
+		return "Timeout"
+	}
+	return ""
+}
+
+// cpu returns the CPU used since the first tick, or since the controller
+// was made if there was none. Call it once the workers have stopped.
+func (c *controller) cpu() CPUStats {
+	return cpuBetween(c.cpuFrom, takeCPUSample(), atomic.LoadInt64(&c.ops)-c.cpuFromOps)
+}
+
+// device returns what the target's block device did over the same window as
+// cpu, or nil if it has none. Call it once the workers have stopped.
+func (c *controller) device() *DeviceStats {
+	if c.disk == nil {
+		return nil
+	}
+	return c.disk.between(c.diskFrom, c.disk.sample())
+}
+
+// addPoint ends the current series interval at elapsed, with ops I/Os done.
+func (c *controller) addPoint(elapsed time.Duration, ops int64) {
+	bytes := atomic.LoadInt64(&c.bytes)
+	lat := c.lat.snapshot()
+	delta := make([]int64, len(lat))
+	for i := range lat {
+		delta[i] = lat[i] - c.seriesLat[i]
+	}
+	dt := (elapsed - c.seriesAt).Seconds()
+	p := SeriesPoint{
+		Time:       elapsed,
+		IOPS:       float64(ops-c.seriesOps) / dt,
+		Throughput: float64(bytes-c.seriesBytes) / dt,
+	}
+	if us, ok := liveQuantile(delta, 0.5); ok {
+		p.P50Latency = time.Duration(us * float64(time.Microsecond))
+	}
+	if us, ok := liveQuantile(delta, 0.99); ok {
+		p.P99Latency = time.Duration(us * float64(time.Microsecond))
+	}
+	c.series = append(c.series, p)
+	c.seriesAt, c.seriesOps, c.seriesBytes, c.seriesLat = elapsed, ops, bytes, lat
+}
+
+// finishSeries closes the last, partial interval at elapsed, the measured
+// duration of the run, and returns the series. Call it once the workers
+// have stopped.
+func (c *controller) finishSeries(elapsed time.Duration) []SeriesPoint {
+	if c.params.SeriesInterval > 0 && elapsed > c.seriesAt {
+		c.addPoint(elapsed, atomic.LoadInt64(&c.ops))
+	}
+	return c.series
+}
+
+// instantIOPS is the IOPS over the last second, for display.
+func (c *controller) instantIOPS() float64 {
+	const window = 10
+	if len(c.samples) == 0 {
+		return 0
+	}
+	if len(c.samples) < window {
+		mean, _ := calculateStats(c.samples)
+		return mean
+	}
+	sum := 0.0
+	for _, s := range c.samples[len(c.samples)-window:] {
+		sum += s
+	}
+	return sum / window
+}
+
+// relStdErr returns the standard error of the mean of xs relative to the
+// mean, and whether the mean is positive.
+func relStdErr(xs []float64) (float64, bool) {
+	mean, stdErr := calculateStats(xs)
+	if mean <= 0 {
+		return 0, false
+	}
+	return stdErr / mean, true
+}
+
+type stderrRule struct{}
+
+func (stderrRule) check(c *controller) (float64, bool) {
+	if len(c.samples) == 0 {
+		return 0, false
+	}
+	relErr, ok := relStdErr(c.samples)
+	return relErr, ok && len(c.samples) > 5 && c.params.ErrorTarget > 0 && relErr <= c.params.ErrorTarget
+}
+
+type batchMeansRule struct{}
+
+func (batchMeansRule) check(c *controller) (float64, bool) {
+	const batches = 10
+	size := len(c.samples) / batches
+	if size < 2 {
+		return stderrRule{}.check(c) // Too early to batch; reported only
+	}
+	recent := c.samples[len(c.samples)-batches*size:]
+	means := make([]float64, batches)
+	for i := range means {
+		means[i], _ = calculateStats(recent[i*size : (i+1)*size])
+	}
+	relErr, ok := relStdErr(means)
+	return relErr, ok && c.params.ErrorTarget > 0 && relErr <= c.params.ErrorTarget
+}
+
+// p99Rule keeps between 10 and 20 batches of latency histograms. When it has
+// 20 it merges neighbours, halving their number and doubling their length,
+// so memory stays bounded however long the point runs.
+type p99Rule struct {
+	last       []int64 // Cumulative counts at the previous tick
+	cur        []int64 // Counts of the batch being filled
+	curTicks   int
+	batchTicks int       // Monitor intervals per batch
+	batches    [][]int64 // Completed batches
+}
+
+func (r *p99Rule) check(c *controller) (float64, bool) {
+	now := c.lat.snapshot()
+	if r.cur == nil {
+		r.cur = make([]int64, liveBuckets)
+		r.last = make([]int64, liveBuckets)
+	}
+	for i := range now {
+		r.cur[i] += now[i] - r.last[i]
+	}
+	r.last = now
+	if r.curTicks++; r.curTicks == r.batchTicks {
+		r.batches = append(r.batches, r.cur)
+		r.cur = make([]int64, liveBuckets)
+		r.curTicks = 0
+		if len(r.batches) == 20 {
+			for i := 0; i < 10; i++ {
+				a, b := r.batches[2*i], r.batches[2*i+1]
+				for j := range a {
+					a[j] += b[j]
+				}
+				r.batches[i] = a
+			}
+			r.batches = r.batches[:10]
+			r.batchTicks *= 2
+		}
+	}
+	if len(r.batches) < 10 {
+		return 0, false
+	}
+	p99s := make([]float64, 0, len(r.batches))
+	for _, b := range r.batches {
+		if v, ok := liveQuantile(b, 0.99); ok {
+			p99s = append(p99s, v)
+		}
+	}
+	if len(p99s) < 10 {
+		return 0, false
+	}
+	relErr, ok := relStdErr(p99s)
+	return relErr, ok && c.params.ErrorTarget > 0 && relErr <= c.params.ErrorTarget
+}
+
+type plateauRule struct{}
+
+func (plateauRule) check(c *controller) (float64, bool) {
+	n := len(c.samples)
+	if n < 20 {
+		return 0, false
+	}
+	window := c.samples[n-max(10, n/2):]
+	// Least-squares slope per sample, times the window length, is the
+	// change in IOPS across the window.
+	var sx, sy, sxx, sxy float64
+	for i, y := range window {
+		x := float64(i)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	w := float64(len(window))
+	mean := sy / w
+	if mean <= 0 {
+		return 0, false
+	}
+	slope := (w*sxy - sx*sy) / (w*sxx - sx*sx)
+	relErr := math.Abs(slope*w) / mean
+	return relErr, c.params.ErrorTarget > 0 && relErr <= c.params.ErrorTarget
+}
+
+type ioCountRule struct {
+	n int64
+}
+
+func (r ioCountRule) check(c *controller) (float64, bool) {
+	relErr, _ := stderrRule{}.check(c)
+	return relErr, atomic.LoadInt64(&c.ops) >= r.n
+}
+
+// liveHist is a latency histogram the workers update while the monitor
+// reads it. Buckets are log-linear with 16 per power of two, about 6%
+// resolution, which is plenty to judge convergence.
+type liveHist struct {
+	counts [liveBuckets]int64
+}
+
+const (
+	liveSubBits = 4
+	liveBuckets = (64 - liveSubBits) << liveSubBits
+)
+
+func liveBucket(us int64) int {
+	if us < 1<<liveSubBits {
+		return int(max(us, 0))
+	}
+	exp := bits.Len64(uint64(us)) - liveSubBits - 1
+	return (exp+1)<<liveSubBits + int(us>>exp) - 1<<liveSubBits
+}
+
+// liveBucketMid returns the middle of bucket i in µs.
+func liveBucketMid(i int) float64 {
+	if i < 1<<liveSubBits {
+		return float64(i)
+	}
+	exp := i>>liveSubBits - 1
+	lo := int64(i&(1<<liveSubBits-1)+1<<liveSubBits) << exp
+	return float64(lo) + float64(int64(1)<<exp)/2
+}
+
+func (h *liveHist) record(us int64) {
+	atomic.AddInt64(&h.counts[liveBucket(us)], 1)
+}
+
+func (h *liveHist) snapshot() []int64 {
+	s := make([]int64, liveBuckets)
+	for i := range s {
+		s[i] = atomic.LoadInt64(&h.counts[i])
+	}
+	return s
+}
+
+// liveQuantile returns quantile q (0-1) of the bucket counts, false if they
+// are empty.
+func liveQuantile(counts []int64, q float64) (float64, bool) {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+	target := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, n := range counts {
+		if seen += n; seen >= target {
+			return liveBucketMid(i), true
+		}
+	}
+	return liveBucketMid(len(counts) - 1), true
+}
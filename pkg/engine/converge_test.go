@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// drive feeds c ticks of 100ms with opsAt(i) I/Os of latency latAt(i) µs in
+// tick i, and returns the tick it stopped at and why, or -1 and "".
+func drive(c *controller, ticks int, opsAt func(int) int, latAt func(int) int64) (int, string) {
+	for i := 0; i < ticks; i++ {
+		for j := opsAt(i); j > 0; j-- {
+			c.record(latAt(i), 4096)
+		}
+		if reason := c.tick(time.Duration(i+1) * 100 * time.Millisecond); reason != "" {
+			return i, reason
+		}
+	}
+	return -1, ""
+}
+
+func TestStopRules(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	steady := func(int) int { return 1000 + r.Intn(50) }
+	lat := func(int) int64 { return 100 + r.Int63n(100) }
+
+	for _, rule := range []string{"stderr", "batch_means", "p99_ci", "plateau", "io_count"} {
+		c, err := newController(Params{StopRule: rule, StopIOs: 5000, ErrorTarget: 0.02, MinRuntime: 200 * time.Millisecond, MaxRuntime: 10 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tick, reason := drive(c, 200, steady, lat)
+		if want := "Converged (" + rule + ")"; reason != want {
+			t.Errorf("%s: stopped with %q, want %q", rule, reason, want)
+		}
+		if rule == "io_count" && tick != 4 {
+			t.Errorf("io_count stopped at tick %d, want 4 (5000 I/Os)", tick)
+		}
+	}
+
+	// IOPS climbing 1% per tick is stable enough for stderr once there are
+	// many samples, but never a plateau.
+	c, err := newController(Params{StopRule: "plateau", ErrorTarget: 0.05, MaxRuntime: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reason := drive(c, 200, func(i int) int { return int(1000 * math.Pow(1.01, float64(i))) }, lat)
+	if reason != "Timeout" {
+		t.Errorf("plateau on a rising trend stopped with %q, want Timeout", reason)
+	}
+
+	// P99 that alternates between 100µs and 1ms every few hundred ms never
+	// settles, even though IOPS is flat.
+	c, err = newController(Params{StopRule: "p99_ci", ErrorTarget: 0.02, MaxRuntime: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reason = drive(c, 200, steady, func(i int) int64 {
+		if i/3%2 == 0 {
+			return 100
+		}
+		return 100 + int64(r.Intn(20))*100
+	})
+	if reason != "Timeout" {
+		t.Errorf("p99_ci on unstable latency stopped with %q, want Timeout", reason)
+	}
+
+	if _, err := newController(Params{StopRule: "bogus"}); err == nil {
+		t.Errorf("unknown stop rule accepted")
+	}
+	if _, err := newController(Params{StopRule: "io_count"}); err == nil {
+		t.Errorf("io_count without an I/O count accepted")
+	}
+}
+
+func TestLiveHist(t *testing.T) {
+	for us := int64(0); us < 1<<20; us = us*9/8 + 1 {
+		mid := liveBucketMid(liveBucket(us))
+		if math.Abs(mid-float64(us)) > 0.0625*float64(us)+0.5 {
+			t.Errorf("%dµs lands in a bucket around %gµs", us, mid)
+		}
+	}
+	if b := liveBucket(math.MaxInt64); b >= liveBuckets {
+		t.Errorf("largest latency in bucket %d of %d", b, liveBuckets)
+	}
+
+	var h liveHist
+	for us := int64(1); us <= 1000; us++ {
+		h.record(us)
+	}
+	p99, ok := liveQuantile(h.snapshot(), 0.99)
+	if !ok || math.Abs(p99-990) > 990*0.0625 {
+		t.Errorf("P99 of 1-1000µs = %g, %v", p99, ok)
+	}
+	if _, ok := liveQuantile(make([]int64, liveBuckets), 0.99); ok {
+		t.Errorf("quantile of an empty histogram")
+	}
+}
+
+func TestSimStopRules(t *testing.T) {
+	for _, rule := range []string{"stderr", "batch_means", "p99_ci", "plateau", "io_count"} {
+		params := simParams(4, 32)
+		params.MinRuntime = 500 * time.Millisecond
+		params.MaxRuntime = time.Minute
+		params.ErrorTarget = 0.05
+		params.StopRule = rule
+		params.StopIOs = 100000
+		res, err := NewSim().Run(context.Background(), params)
+		if err != nil {
+			t.Fatalf("%s: %v", rule, err)
+		}
+		if want := "Converged (" + rule + ")"; res.TerminationReason != want {
+			t.Errorf("%s: TerminationReason %q, want %q", rule, res.TerminationReason, want)
+		}
+		if rule == "io_count" && res.TotalIOs < params.StopIOs {
+			t.Errorf("io_count stopped after %d I/Os, want at least %d", res.TotalIOs, params.StopIOs)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// CPUStats is the CPU used during the measurement window of a run. It is
+// zero for the sim engine, whose CPU use says nothing about a device.
+type CPUStats struct {
+	User time.Duration // User time of the jolt process
+	Sys  time.Duration // System time of the jolt process
+	Wall time.Duration // Length of the window
+
+	Pct       float64 // Process CPU (user+sys) as a percentage of one core; 150 is 1.5 cores
+	UserPct   float64
+	SysPct    float64
+	SystemPct float64 // Busy time of the whole machine as a percentage of all its cores
+
+	PerIO       float64 // µs of process CPU per I/O
+	IOPSPerCore float64 // I/Os per second of process CPU, i.e. IOPS per fully used core
+}
+
+// NewCPUStats fills in the derived fields from the process CPU times, the
+// window length and the I/Os done in it.
+func NewCPUStats(user, sys, wall time.Duration, systemPct float64, ios int64) CPUStats {
+	c := CPUStats{User: user, Sys: sys, Wall: wall, SystemPct: systemPct}
+	if wall > 0 {
+		c.UserPct = 100 * user.Seconds() / wall.Seconds()
+		c.SysPct = 100 * sys.Seconds() / wall.Seconds()
+		c.Pct = c.UserPct + c.SysPct
+	}
+	if cpu := (user + sys).Seconds(); ios > 0 && cpu > 0 {
+		c.PerIO = cpu * 1e6 / float64(ios)
+		c.IOPSPerCore = float64(ios) / cpu
+	}
+	return c
+}
+
+// cpuSample is a reading of the process and system CPU counters.
+type cpuSample struct {
+	at        time.Time
+	user, sys time.Duration
+	busy      uint64 // System-wide ticks, from /proc/stat; zero if unavailable
+	total     uint64
+}
+
+func takeCPUSample() cpuSample {
+	s := cpuSample{at: time.Now()}
+	var ru unix.Rusage
+	if unix.Getrusage(unix.RUSAGE_SELF, &ru) == nil {
+		s.user = time.Duration(ru.Utime.Nano())
+		s.sys = time.Duration(ru.Stime.Nano())
+	}
+	s.busy, s.total = systemCPUTicks()
+	return s
+}
+
+// systemCPUTicks returns the busy and total ticks of all CPUs since boot.
+// Idle and iowait count as idle; guest time is already part of user time.
+func systemCPUTicks() (busy, total uint64) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return 0, 0
+	}
+	fields := strings.Fields(sc.Text())
+	if len(fields) < 9 || fields[0] != "cpu" {
+		return 0, 0
+	}
+	// user nice system idle iowait irq softirq steal
+	var idle uint64
+	for i, field := range fields[1:9] {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0
+		}
+		total += n
+		if i == 3 || i == 4 {
+			idle += n
+		}
+	}
+	return total - idle, total
+}
+
+// cpuBetween is the CPU used from a to b, during which ios I/Os were done.
+func cpuBetween(a, b cpuSample, ios int64) CPUStats {
+	var systemPct float64
+	if b.total > a.total {
+		systemPct = 100 * float64(b.busy-a.busy) / float64(b.total-a.total)
+	}
+	return NewCPUStats(b.user-a.user, b.sys-a.sys, b.at.Sub(a.at), systemPct, ios)
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewCPUStats(t *testing.T) {
+	c := NewCPUStats(300*time.Millisecond, 200*time.Millisecond, time.Second, 40, 10000)
+	if c.UserPct != 30 || c.SysPct != 20 || c.Pct != 50 {
+		t.Errorf("percentages %+v", c)
+	}
+	if c.PerIO != 50 || c.IOPSPerCore != 20000 {
+		t.Errorf("per I/O %gµs, %g IOPS/core", c.PerIO, c.IOPSPerCore)
+	}
+	if z := NewCPUStats(0, 0, 0, 0, 0); z.Pct != 0 || z.PerIO != 0 {
+		t.Errorf("empty window gave %+v", z)
+	}
+}
+
+func TestEngineRunCPU(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	params := Params{
+		EngineType: "sync",
+		Path:       tmpFile.Name(),
+		BlockSize:  4096,
+		ReadPct:    100,
+		Rand:       true,
+		Workers:    2,
+		MinRuntime: 300 * time.Millisecond,
+		MaxRuntime: 300 * time.Millisecond,
+	}
+	res, err := mustNew(t, "sync").Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := res.CPU
+	if c.Wall <= 0 || c.Wall > res.Duration+100*time.Millisecond {
+		t.Errorf("CPU window %v for a %v run", c.Wall, res.Duration)
+	}
+	// Two workers spinning on page cache reads keep up to two cores busy.
+	if c.Pct <= 0 || c.Pct > 100*float64(2+1) {
+		t.Errorf("CPU %.0f%%", c.Pct)
+	}
+	if c.PerIO <= 0 || math.Abs(c.PerIO*c.IOPSPerCore-1e6) > 1 {
+		t.Errorf("%gµs per I/O but %g IOPS per core", c.PerIO, c.IOPSPerCore)
+	}
+	t.Logf("CPU %.0f%% (user %.0f%%, sys %.0f%%, system %.0f%%), %.1fµs/IO, %.0f IOPS/core", c.Pct, c.UserPct, c.SysPct, c.SystemPct, c.PerIO, c.IOPSPerCore)
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// opKind is the kind of operation a worker issues.
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opDiscard
+	opWriteZeroes
+)
+
+// pickOp draws the next operation: DiscardPct and WriteZeroesPct of all
+// operations, with ReadPct splitting the rest between reads and writes.
+func pickOp(params Params, r *rand.Rand) opKind {
+	if params.DiscardPct > 0 || params.WriteZeroesPct > 0 {
+		x := r.Intn(100)
+		if x < params.DiscardPct {
+			return opDiscard
+		}
+		if x < params.DiscardPct+params.WriteZeroesPct {
+			return opWriteZeroes
+		}
+	}
+	if params.ReadPct < 100 {
+		if params.ReadPct == 0 || r.Intn(100) >= params.ReadPct {
+			return opWrite
+		}
+	}
+	return opRead
+}
+
+// checkDiscard validates the discard and write-zeroes percentages. Engines
+// that can't issue them pass canDiscard=false to reject them.
+func checkDiscard(params Params, engineType string, canDiscard bool) error {
+	if params.DiscardPct < 0 || params.WriteZeroesPct < 0 || params.DiscardPct+params.WriteZeroesPct > 100 {
+		return fmt.Errorf("invalid discard/write-zeroes percentages: %d/%d", params.DiscardPct, params.WriteZeroesPct)
+	}
+	if params.DiscardPct == 0 && params.WriteZeroesPct == 0 {
+		return nil
+	}
+	if !canDiscard {
+		return fmt.Errorf("discard and write-zeroes are not supported by the %s engine", engineType)
+	}
+	// Discarded blocks no longer hold what the verifier expects.
+	if params.Verify != "" {
+		return fmt.Errorf("verify can't be combined with discard or write-zeroes")
+	}
+	return nil
+}
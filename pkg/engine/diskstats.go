@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeviceStats is what the block layer saw during the measurement window,
+// from the block device's stat file in sysfs (or /proc/diskstats). For a
+// file target it is the device holding the file system, including any other
+// traffic to it. Compare it with the Result to see request merging or
+// kernel-side queueing.
+type DeviceStats struct {
+	Name     string // Kernel name, e.g. "nvme0n1" or "sda2"
+	Duration time.Duration
+
+	Read    DeviceDirStats
+	Write   DeviceDirStats
+	Discard DeviceDirStats
+	Flushes int64
+
+	IOPS        float64 // Requests completed per second, all directions
+	Utilization float64 // Percentage of the window with requests in flight (io_ticks)
+	AvgInFlight float64 // Average requests in flight (time_in_queue over the window)
+
+	IOTicks     time.Duration
+	TimeInQueue time.Duration
+}
+
+// DeviceDirStats counts the requests of one direction at the device.
+type DeviceDirStats struct {
+	IOs     int64 // Requests completed
+	Merges  int64 // Adjacent requests merged into one before reaching the device
+	Sectors int64 // 512 byte sectors transferred
+}
+
+// The fields of a block device stat file, as in
+// Documentation/block/stat.rst.
+const (
+	dsReadIOs = iota
+	dsReadMerges
+	dsReadSectors
+	dsReadTicks
+	dsWriteIOs
+	dsWriteMerges
+	dsWriteSectors
+	dsWriteTicks
+	dsInFlight
+	dsIOTicks
+	dsTimeInQueue
+	dsDiscardIOs
+	dsDiscardMerges
+	dsDiscardSectors
+	dsDiscardTicks
+	dsFlushIOs
+	dsFlushTicks
+	dsFields
+)
+
+// diskDev is a block device whose statistics can be sampled.
+type diskDev struct {
+	name         string
+	major, minor uint32
+}
+
+type diskSample struct {
+	at time.Time
+	f  [dsFields]int64
+	ok bool
+}
+
+// findDiskDev returns the block device behind path, or nil if there is none
+// with statistics, e.g. for tmpfs or the sim engine.
+func findDiskDev(path string) *diskDev {
+	if path == "" {
+		return nil
+	}
+	major, minor, err := blockDevice(path)
+	if err != nil {
+		return nil
+	}
+	d := &diskDev{major: major, minor: minor}
+	if dir, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)); err == nil {
+		d.name = filepath.Base(dir)
+	}
+	if !d.sample().ok {
+		return nil
+	}
+	return d
+}
+
+func (d *diskDev) sample() diskSample {
+	s := diskSample{at: time.Now()}
+	var fields []string
+	if b, err := os.ReadFile(fmt.Sprintf("/sys/dev/block/%d:%d/stat", d.major, d.minor)); err == nil {
+		fields = strings.Fields(string(b))
+	} else if fields = d.procDiskstats(); fields == nil {
+		return s
+	}
+	// Older kernels have no discard or flush fields.
+	if len(fields) < dsDiscardIOs {
+		return s
+	}
+	for i := 0; i < len(fields) && i < dsFields; i++ {
+		n, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return s
+		}
+		s.f[i] = n
+	}
+	s.ok = true
+	return s
+}
+
+// procDiskstats returns the stat fields of d from /proc/diskstats, which
+// has them after the major, minor and name columns.
+func (d *diskDev) procDiskstats() []string {
+	f, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 3 && fields[0] == strconv.Itoa(int(d.major)) && fields[1] == strconv.Itoa(int(d.minor)) {
+			if d.name == "" {
+				d.name = fields[2]
+			}
+			return fields[3:]
+		}
+	}
+	return nil
+}
+
+// between is what the device did from a to b; nil if either sample
+// failed.
+func (d *diskDev) between(a, b diskSample) *DeviceStats {
+	if !a.ok || !b.ok {
+		return nil
+	}
+	delta := func(i int) int64 { return b.f[i] - a.f[i] }
+	ds := &DeviceStats{
+		Name:        d.name,
+		Duration:    b.at.Sub(a.at),
+		Read:        DeviceDirStats{IOs: delta(dsReadIOs), Merges: delta(dsReadMerges), Sectors: delta(dsReadSectors)},
+		Write:       DeviceDirStats{IOs: delta(dsWriteIOs), Merges: delta(dsWriteMerges), Sectors: delta(dsWriteSectors)},
+		Discard:     DeviceDirStats{IOs: delta(dsDiscardIOs), Merges: delta(dsDiscardMerges), Sectors: delta(dsDiscardSectors)},
+		Flushes:     delta(dsFlushIOs),
+		IOTicks:     time.Duration(delta(dsIOTicks)) * time.Millisecond,
+		TimeInQueue: time.Duration(delta(dsTimeInQueue)) * time.Millisecond,
+	}
+	ds.derive()
+	return ds
+}
+
+// derive fills in the rates from the counters.
+func (ds *DeviceStats) derive() {
+	if ds.Duration <= 0 {
+		return
+	}
+	secs := ds.Duration.Seconds()
+	ds.IOPS = float64(ds.Read.IOs+ds.Write.IOs+ds.Discard.IOs) / secs
+	ds.Utilization = min(100, 100*ds.IOTicks.Seconds()/secs)
+	ds.AvgInFlight = ds.TimeInQueue.Seconds() / secs
+}
+
+// MergeDevice adds up the device statistics of sequential runs rs into dst.
+// dst gets none unless every run has them for the same device.
+func MergeDevice(dst *Result, rs ...*Result) {
+	var m *DeviceStats
+	for _, r := range rs {
+		if r == nil || r.Device == nil || (m != nil && r.Device.Name != m.Name) {
+			dst.Device = nil
+			return
+		}
+		d := r.Device
+		if m == nil {
+			m = &DeviceStats{Name: d.Name}
+		}
+		m.Duration += d.Duration
+		for _, p := range [][2]*DeviceDirStats{{&m.Read, &d.Read}, {&m.Write, &d.Write}, {&m.Discard, &d.Discard}} {
+			p[0].IOs += p[1].IOs
+			p[0].Merges += p[1].Merges
+			p[0].Sectors += p[1].Sectors
+		}
+		m.Flushes += d.Flushes
+		m.IOTicks += d.IOTicks
+		m.TimeInQueue += d.TimeInQueue
+	}
+	if m != nil {
+		m.derive()
+	}
+	dst.Device = m
+}
+
+// MergeNodeDevices does what MergeDevice does for each node of sequential
+// cluster runs rs. A node is left out unless every run has its statistics.
+func MergeNodeDevices(dst *Result, rs ...*Result) {
+	dst.NodeDevices = nil
+	if len(rs) == 0 || rs[0] == nil {
+		return
+	}
+	for name := range rs[0].NodeDevices {
+		node := make([]*Result, len(rs))
+		for i, r := range rs {
+			if r == nil {
+				return
+			}
+			node[i] = &Result{Device: r.NodeDevices[name]}
+		}
+		var m Result
+		MergeDevice(&m, node...)
+		if m.Device == nil {
+			continue
+		}
+		if dst.NodeDevices == nil {
+			dst.NodeDevices = make(map[string]*DeviceStats)
+		}
+		dst.NodeDevices[name] = m.Device
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeviceBetween(t *testing.T) {
+	d := &diskDev{name: "sda"}
+	now := time.Now()
+	a := diskSample{at: now, ok: true}
+	b := diskSample{at: now.Add(2 * time.Second), ok: true}
+	b.f[dsReadIOs], b.f[dsReadMerges], b.f[dsReadSectors] = 1000, 3000, 32000
+	b.f[dsWriteIOs], b.f[dsWriteSectors] = 1000, 8000
+	b.f[dsIOTicks], b.f[dsTimeInQueue] = 1500, 8000
+	b.f[dsFlushIOs] = 7
+
+	ds := d.between(a, b)
+	if ds.IOPS != 1000 || ds.Utilization != 75 || ds.AvgInFlight != 4 {
+		t.Errorf("%.0f IOPS, %.0f%% busy, %.1f in flight; want 1000, 75%%, 4", ds.IOPS, ds.Utilization, ds.AvgInFlight)
+	}
+	if ds.Read.Merges != 3000 || ds.Write.Sectors != 8000 || ds.Flushes != 7 {
+		t.Errorf("counters %+v", ds)
+	}
+	if d.between(a, diskSample{}) != nil {
+		t.Errorf("stats from a failed sample")
+	}
+
+	var merged Result
+	r := &Result{Device: ds}
+	MergeDevice(&merged, r, r)
+	if m := merged.Device; m == nil || m.Read.IOs != 2000 || m.Duration != 4*time.Second || m.IOPS != 1000 {
+		t.Errorf("merged %+v", m)
+	}
+	MergeDevice(&merged, r, &Result{})
+	if merged.Device != nil {
+		t.Errorf("merged with a run without device stats")
+	}
+
+	c := &Result{NodeDevices: map[string]*DeviceStats{"a": ds, "b": ds}}
+	MergeNodeDevices(&merged, c, &Result{NodeDevices: map[string]*DeviceStats{"a": ds}})
+	if len(merged.NodeDevices) != 1 || merged.NodeDevices["a"].Read.IOs != 2000 {
+		t.Errorf("merged nodes %+v", merged.NodeDevices)
+	}
+}
+
+func TestEngineRunDeviceStats(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-diskstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	if findDiskDev(tmpFile.Name()) == nil {
+		t.Skip("temp dir isn't on a block device")
+	}
+
+	params := Params{
+		EngineType: "sync",
+		Path:       tmpFile.Name(),
+		BlockSize:  4096,
+		ReadPct:    0,
+		Workers:    1,
+		MinRuntime: 200 * time.Millisecond,
+		MaxRuntime: 200 * time.Millisecond,
+		FsyncEvery: 16,
+	}
+	res, err := mustNew(t, "sync").Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := res.Device
+	if ds == nil || ds.Name == "" {
+		t.Fatalf("no device stats: %+v", ds)
+	}
+	// The fsyncs push writes to the device during the window.
+	if ds.Write.IOs == 0 || ds.Write.Sectors == 0 || ds.Duration <= 0 {
+		t.Errorf("device saw no writes: %+v", ds)
+	}
+	if res, err = NewSim().Run(context.Background(), simParams(1, 1)); err != nil || res.Device != nil {
+		t.Errorf("sim has device stats: %v, %v", res.Device, err)
+	}
+}
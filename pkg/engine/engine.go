@@ -1,13 +1,12 @@
 package engine
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"math"
 	"math/rand"
 	"os"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
@@ -24,30 +23,59 @@ func NewSync() *SyncEngine {
 
 func (e *SyncEngine) NumNodes() int { return 1 }
 
-// New returns an Engine of the requested type.
-func New(engineType string) Engine {
-	switch engineType {
-	case "uring":
-		return NewUring()
-	case "libaio":
-		return NewLibAIO()
-	default:
-		return NewSync()
-	}
+func init() {
+	Register(Registration{
+		Name:        "sync",
+		Description: "Blocking pread/pwrite, one I/O in flight per worker",
+		Caps:        Capabilities{Direct: true},
+		Fio:         "sync",
+		New:         func() Engine { return NewSync() },
+	})
 }
 
 // Run executes a workload based on the provided params.
-func (e *SyncEngine) Run(params Params) (*Result, error) {
-	if params.BlockSize <= 0 {
-		return nil, fmt.Errorf("invalid block size: %d", params.BlockSize)
+func (e *SyncEngine) Run(ctx context.Context, params Params) (*Result, error) {
+	if len(params.Groups) > 0 {
+		return runGroups(ctx, e, params)
+	}
+	sizes, err := newBlockSizes(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseDistribution(params.Distribution); err != nil {
+		return nil, err
+	}
+	v, err := newVerifier(params, sizes)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFlush(params, "sync", true); err != nil {
+		return nil, err
+	}
+	if err := checkData(params, "sync", true); err != nil {
+		return nil, err
+	}
+	if err := checkThink(params, "sync", true); err != nil {
+		return nil, err
+	}
+	if err := checkArrival(params); err != nil {
+		return nil, err
+	}
+	if err := checkDiscard(params, "sync", true); err != nil {
+		return nil, err
+	}
+	ctl, err := newController(params)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := newPlacer(params)
+	if err != nil {
+		return nil, err
 	}
 
 	var wg sync.WaitGroup
 	results := make(chan workerResult, params.Workers)
 	done := make(chan struct{})
-	
-	// Atomic counter for live monitoring
-	var opsCounter int64
 
 	// Create token bucket for Global Queue Depth enforcement.
 	// In the SyncEngine, "Queue Depth" effectively limits the maximum number of
@@ -63,14 +91,16 @@ func (e *SyncEngine) Run(params Params) (*Result, error) {
 		tokens <- struct{}{}
 	}
 
-	start := time.Now()
+	// Measurement starts once the ramp is over. Workers keep issuing I/O
+	// during the ramp but don't record it.
+	start := time.Now().Add(params.RampTime)
 	var reason string
 
 	for i := 0; i < params.Workers; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			results <- e.runWorker(id, params, tokens, done, &opsCounter)
+			results <- e.runWorker(id, params, sizes, v, start, tokens, done, ctl, pl)
 		}(i)
 	}
 
@@ -78,79 +108,17 @@ func (e *SyncEngine) Run(params Params) (*Result, error) {
 	monitorTicker := time.NewTicker(100 * time.Millisecond)
 	defer monitorTicker.Stop()
 
-	var iopsSamples []float64
-	var lastOps int64
-	var lastTime = start
-	var finalRelErr float64
-
 	for {
 		select {
+		case <-ctx.Done():
+			reason = "Cancelled"
+			goto Finished
 		case <-monitorTicker.C:
 			now := time.Now()
-			elapsed := now.Sub(start)
-			
-			currOps := atomic.LoadInt64(&opsCounter)
-			deltaOps := currOps - lastOps
-			deltaTime := now.Sub(lastTime).Seconds()
-			
-			if deltaTime > 0 {
-				sample := float64(deltaOps) / deltaTime
-				iopsSamples = append(iopsSamples, sample)
+			if now.Before(start) {
+				continue // Still ramping
 			}
-			
-			lastOps = currOps
-			lastTime = now
-
-			// Calculate intermediate stats
-						var mean, stdErr float64
-						if len(iopsSamples) > 0 {
-							mean, stdErr = calculateStats(iopsSamples)
-						}
-						if mean > 0 {
-							finalRelErr = stdErr / mean
-						}
-			
-						// Calculate Instantaneous IOPS (Last 10 samples = 1 second) for display
-						var instantIOPS float64
-						window := 10
-						if len(iopsSamples) == 0 {
-							instantIOPS = 0
-						} else if len(iopsSamples) < window {
-							instantIOPS = mean
-						} else {
-							sum := 0.0
-							for k := 0; k < window; k++ {
-								sum += iopsSamples[len(iopsSamples)-1-k]
-							}
-							instantIOPS = sum / float64(window)
-						}
-			
-						if params.Progress != nil {
-							params.Progress(Result{
-								IOPS:             instantIOPS,
-								MetricConfidence: finalRelErr,
-								Duration:         elapsed,
-								TotalIOs:         currOps,
-							})
-						}
-			
-
-			// Check termination conditions
-			if elapsed > params.MinRuntime {
-				if len(iopsSamples) > 5 {
-					if mean > 0 {
-						if params.ErrorTarget > 0 {
-							if finalRelErr <= params.ErrorTarget {
-								reason = "Converged"
-								goto Finished
-							}
-						}
-					}
-				}
-			}
-
-			if params.MaxRuntime > 0 && elapsed >= params.MaxRuntime {
-				reason = "Timeout"
+			if reason = ctl.tick(now.Sub(start)); reason != "" {
 				goto Finished
 			}
 		}
@@ -159,15 +127,26 @@ func (e *SyncEngine) Run(params Params) (*Result, error) {
 Finished:
 	close(done)
 	wg.Wait()
+	cpu := ctl.cpu()
+	dev := ctl.device()
 	close(results)
 
 	duration := time.Since(start)
-	res, err := e.aggregate(results, duration, finalRelErr)
+	res, err := e.aggregate(results, duration, ctl.relErr)
 	if err != nil {
 		return nil, err
 	}
-	res.Throughput = float64(res.TotalIOs*int64(params.BlockSize)) / duration.Seconds()
 	res.TerminationReason = reason
+	res.Placement = pl.placement(params)
+	res.CPU = cpu
+	res.Device = dev
+	res.Series = ctl.finishSeries(duration)
+	if err := finishVerify(ctx, v, params, res); err != nil {
+		return nil, err
+	}
+	if reason == "Cancelled" {
+		return res, ctx.Err()
+	}
 	return res, nil
 }
 
@@ -189,28 +168,141 @@ func calculateStats(samples []float64) (mean float64, stdErr float64) {
 
 type workerResult struct {
 	ioCount   int64
+	bytes     int64
+	offered   int64 // Arrivals scheduled in open-loop mode
 	hist      *hdrhistogram.Histogram
+	read      dirResult
+	write     dirResult
+	flush     dirResult // fsync/fdatasync calls; bytes unused
+	discard   dirResult
+	zeroes    dirResult // Write-zeroes
+	slat      dirResult // Async engines: submission and completion
+	clat      dirResult // latency of data I/Os; bytes unused
 	err       error
 }
 
-func (e *SyncEngine) runWorker(id int, params Params, tokens chan struct{}, done chan struct{}, opsCounter *int64) workerResult {
+// dirResult holds one worker's counters for a single I/O direction.
+type dirResult struct {
+	ioCount int64
+	bytes   int64
+	hist    *hdrhistogram.Histogram
+}
+
+func (d *dirResult) merge(o dirResult) {
+	d.ioCount += o.ioCount
+	d.bytes += o.bytes
+	d.hist.Merge(o.hist)
+}
+
+// latency returns the latency of d as DirStats, with only TotalIOs besides
+// the latency fields set.
+func (d dirResult) latency() (DirStats, error) {
+	if d.ioCount == 0 {
+		return DirStats{}, nil
+	}
+	s := DirStats{TotalIOs: d.ioCount}
+	err := s.SetLatency(d.hist)
+	return s, err
+}
+
+// stats returns d as DirStats for a run of secs seconds, zero if d is empty.
+func (d dirResult) stats(secs float64) (DirStats, error) {
+	if d.ioCount == 0 {
+		return DirStats{}, nil
+	}
+	s := DirStats{TotalIOs: d.ioCount, Bytes: d.bytes, IOPS: float64(d.ioCount) / secs, Throughput: float64(d.bytes) / secs}
+	err := s.SetLatency(d.hist)
+	return s, err
+}
+
+func newWorkerResult() workerResult {
+	return workerResult{
+		hist:  NewHistogram(),
+		read:  dirResult{hist: NewHistogram()},
+		write: dirResult{hist: NewHistogram()},
+		flush: dirResult{hist: NewHistogram()},
+		discard: dirResult{hist: NewHistogram()},
+		zeroes:  dirResult{hist: NewHistogram()},
+		slat:    dirResult{hist: NewHistogram()},
+		clat:    dirResult{hist: NewHistogram()},
+	}
+}
+
+// record accounts for one completed I/O of n bytes with the given latency in
+// µs.
+func (w *workerResult) record(isRead bool, us int64, n int) {
+	d := &w.write
+	if isRead {
+		d = &w.read
+	}
+	w.ioCount++
+	d.ioCount++
+	w.bytes += int64(n)
+	d.bytes += int64(n)
+	_ = w.hist.RecordValue(us)
+	_ = d.hist.RecordValue(us)
+}
+
+// recordRange accounts for one discard, or write-zeroes if zero is set, of n
+// bytes. It is an I/O like any other, but the totals' bytes only count data
+// actually transferred.
+func (w *workerResult) recordRange(zero bool, us int64, n int) {
+	d := &w.discard
+	if zero {
+		d = &w.zeroes
+	}
+	w.ioCount++
+	d.ioCount++
+	d.bytes += int64(n)
+	_ = w.hist.RecordValue(us)
+	_ = d.hist.RecordValue(us)
+}
+
+// recordSplit accounts for the submission and completion latency, in µs, of
+// an I/O the async engines have also passed to record. queued is when it was
+// queued for submission, submitted when the submit call returned and end
+// when its completion was seen.
+func (w *workerResult) recordSplit(queued, submitted, end time.Time) {
+	w.slat.ioCount++
+	w.clat.ioCount++
+	_ = w.slat.hist.RecordValue(submitted.Sub(queued).Microseconds())
+	_ = w.clat.hist.RecordValue(end.Sub(submitted).Microseconds())
+}
+
+// recordFlush accounts for one fsync or fdatasync that took us µs.
+func (w *workerResult) recordFlush(us int64) {
+	w.flush.ioCount++
+	_ = w.flush.hist.RecordValue(us)
+}
+
+func (e *SyncEngine) runWorker(id int, params Params, sizes blockSizes, v *verifier, measureFrom time.Time, tokens chan struct{}, done chan struct{}, ctl *controller, pl *placer) workerResult {
+	if err := pl.pin(id); err != nil {
+		return workerResult{err: err}
+	}
 	flags := os.O_RDONLY
-	if params.ReadPct < 100 {
+	if params.ReadPct < 100 || params.DiscardPct > 0 || params.WriteZeroesPct > 0 {
 		flags = os.O_RDWR
 	}
 	if params.Direct {
 		flags |= O_DIRECT
 	}
+	syncFlag, _ := syncOpenFlag(params.SyncMode)
+	flags |= syncFlag
 
 	f, err := os.OpenFile(params.Path, flags, 0666)
 	if err != nil {
 		return workerResult{err: err}
 	}
 	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return workerResult{err: err}
+	}
+	isDev := st.Mode()&os.ModeDevice != 0
 
-	alignedBlock, err := unix.Mmap(-1, 0, params.BlockSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	alignedBlock, err := pl.mmap(sizes.max)
 	if err != nil {
-		return workerResult{err: fmt.Errorf("failed to allocate aligned memory: %v", err)}
+		return workerResult{err: err}
 	}
 	defer unix.Munmap(alignedBlock)
 
@@ -222,60 +314,120 @@ func (e *SyncEngine) runWorker(id int, params Params, tokens chan struct{}, done
 		return workerResult{err: err}
 	}
 	
-	maxBlocks := size / int64(params.BlockSize)
-	if maxBlocks <= 0 {
-		return workerResult{err: fmt.Errorf("file too small for block size")}
+	rg, err := workerRegion(params, sizes, size, id, params.Workers)
+	if err != nil {
+		return workerResult{err: err}
 	}
 
-	var ioCount int64
-	hist := hdrhistogram.New(1, 3600000000, 3)
+	wr := newWorkerResult()
 	
 	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	gen := newDataGen(params, 1, r.Int63())
+	offsets, err := newOffsetGen(params, rg, 0, r)
+	if err != nil {
+		return workerResult{err: err}
+	}
+
+	pace := newPacer(params, id, params.Workers, time.Now(), r)
+	th := newThinker(params, r)
 
 	var traceSpans []Span
 	const traceBatchSize = 1000
+	writes := 0 // Since the last flush
+
+	finish := func() workerResult {
+		if pace != nil {
+			wr.offered += pace.Due(time.Now())
+		}
+		if params.TraceChannel != nil && len(traceSpans) > 0 {
+			params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: math.MaxInt64}
+		}
+		return wr
+	}
 
 	for {
+		var intended time.Time
+		if pace != nil {
+			intended = pace.Next()
+			if !intended.Before(measureFrom) {
+				wr.offered++
+			}
+			if !sleepUntil(intended, params.SpinWait, done) {
+				return finish()
+			}
+		}
+		if !th.wait(done) {
+			return finish()
+		}
+
 		select {
 		case <-done:
-			if params.TraceChannel != nil && len(traceSpans) > 0 {
-				params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: math.MaxInt64}
-			}
-			return workerResult{ioCount: ioCount, hist: hist}
+			return finish()
 		case <-tokens:
 			// Acquired token
 		}
+		th.issued(time.Now())
 
-		offset := int64(0)
-		if params.Rand {
-			offset = r.Int63n(maxBlocks) * int64(params.BlockSize)
-		} else {
-			offset = (ioCount * int64(params.BlockSize)) % (maxBlocks * int64(params.BlockSize))
+		// Decide Read vs Write (or discard/write-zeroes, sized like writes)
+		op := pickOp(params, r)
+		isRead := op == opRead
+
+		buf := alignedBlock[:sizes.pick(isRead, r)]
+		offset := offsets.Next(len(buf))
+		prepStart := time.Now()
+		if op == opRead || op == opWrite {
+			gen.prepare(buf, 0, isRead)
 		}
 
-		// Decide Read vs Write
-		isRead := true
-		if params.ReadPct < 100 {
-			if params.ReadPct == 0 || r.Intn(100) >= params.ReadPct {
-				isRead = false
-			}
+		var seq uint64
+		if v != nil && !isRead {
+			seq = v.fill(buf, offset)
+		} else if v != nil {
+			seq = v.reading(offset)
 		}
 
 		ioStart := time.Now()
 		var n int
-		if isRead {
-			n, err = f.ReadAt(alignedBlock, offset)
-		} else {
-			n, err = f.WriteAt(alignedBlock, offset)
+		switch op {
+		case opRead:
+			n, err = f.ReadAt(buf, offset)
+		case opWrite:
+			n, err = f.WriteAt(buf, offset)
+		default:
+			if err = discardRange(f, isDev, op == opWriteZeroes, offset, int64(len(buf))); err == nil {
+				n = len(buf)
+			}
 		}
 		ioEnd := time.Now()
+
+		if v != nil && err == nil {
+			v.completed(buf, isRead, offset, seq)
+		}
+
+		// The flush holds on to the token; it is an outstanding operation
+		// like any other.
+		if op == opWrite && err == nil && params.FsyncEvery > 0 {
+			writes++
+			if writes >= params.FsyncEvery {
+				writes = 0
+				flushStart := time.Now()
+				if params.Fdatasync {
+					err = unix.Fdatasync(int(f.Fd()))
+				} else {
+					err = f.Sync()
+				}
+				if flushEnd := time.Now(); err == nil && !flushEnd.Before(measureFrom) {
+					wr.recordFlush(flushEnd.Sub(flushStart).Microseconds())
+				}
+			}
+		}
 		
 		// Release token
 		tokens <- struct{}{}
+		th.completed(time.Now())
 		
-		_ = hist.RecordValue(time.Since(ioStart).Microseconds())
-
-		if params.TraceChannel != nil {
+		ramping := ioEnd.Before(measureFrom)
+		if params.TraceChannel != nil && !ramping {
 			traceSpans = append(traceSpans, Span{Start: ioStart.UnixNano(), End: ioEnd.UnixNano()})
 			if len(traceSpans) >= traceBatchSize {
 				params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: ioEnd.UnixNano()}
@@ -286,16 +438,34 @@ func (e *SyncEngine) runWorker(id int, params Params, tokens chan struct{}, done
 		if err != nil && err != io.EOF {
 			return workerResult{err: err}
 		}
-		if n > 0 {
-			ioCount++
-			atomic.AddInt64(opsCounter, 1)
+		if n > 0 && !ramping {
+			latStart := ioStart
+			if pace != nil {
+				// Generating the data isn't part of the I/O's latency.
+				latStart = intended.Add(ioStart.Sub(prepStart))
+			}
+			us := ioEnd.Sub(latStart).Microseconds()
+			if op == opDiscard || op == opWriteZeroes {
+				wr.recordRange(op == opWriteZeroes, us, n)
+				ctl.record(us, 0)
+			} else {
+				wr.record(isRead, us, n)
+				ctl.record(us, int64(n))
+			}
 		}
 	}
 }
 
 func (e *SyncEngine) aggregate(results chan workerResult, duration time.Duration, relErr float64) (*Result, error) {
-	var totalIOs int64
-	hist := hdrhistogram.New(1, 3600000000, 3)
+	var totalIOs, totalBytes, offered int64
+	hist := NewHistogram()
+	read := dirResult{hist: NewHistogram()}
+	write := dirResult{hist: NewHistogram()}
+	flush := dirResult{hist: NewHistogram()}
+	discard := dirResult{hist: NewHistogram()}
+	zeroes := dirResult{hist: NewHistogram()}
+	slat := dirResult{hist: NewHistogram()}
+	clat := dirResult{hist: NewHistogram()}
 	var firstErr error
 
 	for res := range results {
@@ -306,27 +476,66 @@ func (e *SyncEngine) aggregate(results chan workerResult, duration time.Duration
 			continue
 		}
 		totalIOs += res.ioCount
+		offered += res.offered
+		totalBytes += res.bytes
 		hist.Merge(res.hist)
+		read.merge(res.read)
+		write.merge(res.write)
+		flush.merge(res.flush)
+		discard.merge(res.discard)
+		zeroes.merge(res.zeroes)
+		slat.merge(res.slat)
+		clat.merge(res.clat)
 	}
 
 	if firstErr != nil {
 		return nil, firstErr
 	}
 
+	// A run cancelled during the ramp has no measured duration at all.
+	duration = max(duration, 0)
+	var offeredIOPS float64
+	if duration > 0 {
+		offeredIOPS = float64(offered) / duration.Seconds()
+	}
 	if totalIOs == 0 {
-		return &Result{Duration: duration, MetricConfidence: relErr}, nil
+		return &Result{Duration: duration, MetricConfidence: relErr, OfferedIOPS: offeredIOPS}, nil
 	}
 
-	return &Result{
-		IOPS:             float64(totalIOs) / duration.Seconds(),
-		Throughput:       0, // Calculated in Run
-		MeanLatency:      time.Duration(hist.Mean() * float64(time.Microsecond)),
-		P50Latency:       time.Duration(hist.ValueAtQuantile(50.0)) * time.Microsecond,
-		P95Latency:       time.Duration(hist.ValueAtQuantile(95.0)) * time.Microsecond,
-		P99Latency:       time.Duration(hist.ValueAtQuantile(99.0)) * time.Microsecond,
-		P999Latency:      time.Duration(hist.ValueAtQuantile(99.9)) * time.Microsecond,
+	secs := duration.Seconds()
+	res := &Result{
+		IOPS:             float64(totalIOs) / secs,
+		Throughput:       float64(totalBytes) / secs,
 		TotalIOs:         totalIOs,
+		Bytes:            totalBytes,
 		Duration:         duration,
 		MetricConfidence: relErr,
-	}, nil
+		OfferedIOPS:      offeredIOPS,
+	}
+	if err := res.SetLatency(hist); err != nil {
+		return nil, err
+	}
+	var err error
+	if res.Read, err = read.stats(secs); err != nil {
+		return nil, err
+	}
+	if res.Write, err = write.stats(secs); err != nil {
+		return nil, err
+	}
+	if res.Flush, err = flush.stats(secs); err != nil {
+		return nil, err
+	}
+	if res.Discard, err = discard.stats(secs); err != nil {
+		return nil, err
+	}
+	if res.WriteZeroes, err = zeroes.stats(secs); err != nil {
+		return nil, err
+	}
+	if res.Slat, err = slat.latency(); err != nil {
+		return nil, err
+	}
+	if res.Clat, err = clat.latency(); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
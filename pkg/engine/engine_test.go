@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -20,7 +21,7 @@ func TestEngineRun(t *testing.T) {
 	}
 	tmpFile.Close()
 
-	eng := New("sync")
+	eng := mustNew(t, "sync")
 	params := Params{
 		EngineType:  "sync",
 		Path:        tmpFile.Name(),
@@ -34,7 +35,7 @@ func TestEngineRun(t *testing.T) {
 		ErrorTarget: 0.1,
 	}
 
-	result, err := eng.Run(params)
+	result, err := eng.Run(context.Background(), params)
 	if err != nil {
 		t.Fatalf("Run failed: %v", err)
 	}
@@ -46,4 +47,374 @@ func TestEngineRun(t *testing.T) {
 		t.Errorf("Expected positive TotalIOs, got %d", result.TotalIOs)
 	}
 	t.Logf("IOPS: %f, P99 Latency: %v", result.IOPS, result.P99Latency)
-}
\ No newline at end of file
+}
+
+func TestEngineRunMixedDirections(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	eng := mustNew(t, "sync")
+	params := Params{
+		EngineType: "sync",
+		Path:       tmpFile.Name(),
+		BlockSize:  4096,
+		ReadPct:    50,
+		Rand:       true,
+		Workers:    2,
+		MinRuntime: 100 * time.Millisecond,
+		MaxRuntime: 200 * time.Millisecond,
+	}
+
+	result, err := eng.Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Read.TotalIOs <= 0 || result.Write.TotalIOs <= 0 {
+		t.Fatalf("Expected both reads and writes, got %d/%d", result.Read.TotalIOs, result.Write.TotalIOs)
+	}
+	if result.Read.TotalIOs+result.Write.TotalIOs != result.TotalIOs {
+		t.Errorf("Read (%d) + Write (%d) != Total (%d)", result.Read.TotalIOs, result.Write.TotalIOs, result.TotalIOs)
+	}
+	// Page-cache writes can take under a microsecond, so check that every
+	// write's latency was recorded rather than that the percentiles are set.
+	h, err := DecodeHistogram(result.Write.Histogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.TotalCount() != result.Write.TotalIOs {
+		t.Errorf("Expected %d write latencies, got %d", result.Write.TotalIOs, h.TotalCount())
+	}
+}
+
+func TestEngineRunOpenLoop(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, arrival := range []string{"fixed", "poisson"} {
+		params := Params{
+			EngineType: "sync",
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    100,
+			Rand:       true,
+			Workers:    2,
+			TargetIOPS: 2000,
+			Arrival:    arrival,
+			MinRuntime: 500 * time.Millisecond,
+			MaxRuntime: 500 * time.Millisecond,
+		}
+
+		result, err := mustNew(t, "sync").Run(context.Background(), params)
+		if err != nil {
+			t.Fatalf("%s: Run failed: %v", arrival, err)
+		}
+		// A page-cache backed file keeps up easily, so achieved ~= offered.
+		if result.OfferedIOPS < 1500 || result.OfferedIOPS > 2500 {
+			t.Errorf("%s: OfferedIOPS = %.0f, want ~2000", arrival, result.OfferedIOPS)
+		}
+		if result.IOPS < 1500 || result.IOPS > 2500 {
+			t.Errorf("%s: IOPS = %.0f, want ~2000", arrival, result.IOPS)
+		}
+	}
+
+	params := Params{Path: tmpFile.Name(), BlockSize: 4096, TargetIOPS: 2000, Arrival: "bursty"}
+	if _, err := mustNew(t, "sync").Run(context.Background(), params); err == nil {
+		t.Errorf("unknown arrival process accepted")
+	}
+	params.Arrival, params.TargetIOPS = "fixed", 2e9
+	if _, err := mustNew(t, "sync").Run(context.Background(), params); err == nil {
+		t.Errorf("rate with a zero interval accepted")
+	}
+}
+
+func TestEngineRunRampTime(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-ramp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring", "libaio"} {
+		params := Params{
+			EngineType: engineType,
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    100,
+			Rand:       true,
+			Workers:    2,
+			QueueDepth: 2,
+			TargetIOPS: 2000,
+			RampTime:   500 * time.Millisecond,
+			MinRuntime: 500 * time.Millisecond,
+			MaxRuntime: 500 * time.Millisecond,
+		}
+
+		start := time.Now()
+		result, err := mustNew(t, engineType).Run(context.Background(), params)
+		if err != nil {
+			t.Logf("%s: skipping, run failed: %v", engineType, err)
+			continue
+		}
+		if wall := time.Since(start); wall < time.Second {
+			t.Errorf("%s: run took %v, expected ramp plus runtime", engineType, wall)
+		}
+		// Only the ~1000 post-ramp I/Os count, not the ~2000 issued overall.
+		if result.Duration > 700*time.Millisecond {
+			t.Errorf("%s: Duration = %v includes the ramp", engineType, result.Duration)
+		}
+		if result.TotalIOs < 700 || result.TotalIOs > 1300 {
+			t.Errorf("%s: TotalIOs = %d, want ~1000", engineType, result.TotalIOs)
+		}
+		if result.IOPS < 1500 || result.IOPS > 2500 {
+			t.Errorf("%s: IOPS = %.0f, want ~2000", engineType, result.IOPS)
+		}
+	}
+}
+
+func TestEngineRunFsync(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-fsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring"} {
+		for _, datasync := range []bool{false, true} {
+			params := Params{
+				EngineType: engineType,
+				Path:       tmpFile.Name(),
+				BlockSize:  4096,
+				ReadPct:    0,
+				Rand:       true,
+				Workers:    1,
+				QueueDepth: 1,
+				SyncMode:   "dsync",
+				FsyncEvery: 4,
+				Fdatasync:  datasync,
+				MinRuntime: 200 * time.Millisecond,
+				MaxRuntime: 200 * time.Millisecond,
+			}
+			result, err := mustNew(t, engineType).Run(context.Background(), params)
+			if err != nil {
+				t.Logf("%s: skipping, run failed: %v", engineType, err)
+				continue
+			}
+			// One worker at QD 1 flushes after every fourth write.
+			want := result.Write.TotalIOs / 4
+			if result.Flush.TotalIOs < want-1 || result.Flush.TotalIOs > want+1 {
+				t.Errorf("%s (fdatasync=%v): %d flushes for %d writes, want ~%d", engineType, datasync, result.Flush.TotalIOs, result.Write.TotalIOs, want)
+			}
+			if result.Flush.TotalIOs > 0 && result.Flush.P99Latency <= 0 {
+				t.Errorf("%s (fdatasync=%v): no flush latency", engineType, datasync)
+			}
+			if result.TotalIOs != result.Read.TotalIOs+result.Write.TotalIOs {
+				t.Errorf("%s (fdatasync=%v): TotalIOs = %d includes flushes", engineType, datasync, result.TotalIOs)
+			}
+		}
+	}
+
+	bad := []Params{
+		{EngineType: "libaio", FsyncEvery: 4},
+		{EngineType: "sync", SyncMode: "osync"},
+		{EngineType: "sync", Fdatasync: true},
+	}
+	for _, p := range bad {
+		p.Path = tmpFile.Name()
+		p.BlockSize = 4096
+		if _, err := mustNew(t, p.EngineType).Run(context.Background(), p); err == nil {
+			t.Errorf("%+v: expected an error", p)
+		}
+	}
+}
+
+func TestEngineRunDiscard(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-discard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	data := make([]byte, 1024*1024)
+	for i := range data {
+		data[i] = 0xff
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	params := Params{
+		EngineType:     "sync",
+		Path:           tmpFile.Name(),
+		BlockSize:      4096,
+		ReadPct:        100, // Writes would zero blocks too
+		DiscardPct:     20,
+		WriteZeroesPct: 10,
+		Rand:           true,
+		Workers:        2,
+		MinRuntime:     200 * time.Millisecond,
+		MaxRuntime:     200 * time.Millisecond,
+	}
+	result, err := mustNew(t, "sync").Run(context.Background(), params)
+	if err != nil {
+		t.Skipf("run failed, filesystem may not support hole punching: %v", err)
+	}
+	if result.Discard.TotalIOs == 0 || result.WriteZeroes.TotalIOs == 0 {
+		t.Fatalf("no discards (%d) or write-zeroes (%d)", result.Discard.TotalIOs, result.WriteZeroes.TotalIOs)
+	}
+	if result.Discard.P99Latency <= 0 || result.WriteZeroes.P99Latency <= 0 {
+		t.Errorf("missing latency: discard %v, write-zeroes %v", result.Discard.P99Latency, result.WriteZeroes.P99Latency)
+	}
+	if sum := result.Read.TotalIOs + result.Write.TotalIOs + result.Discard.TotalIOs + result.WriteZeroes.TotalIOs; sum != result.TotalIOs {
+		t.Errorf("TotalIOs = %d, per-op sum %d", result.TotalIOs, sum)
+	}
+	if result.Bytes != result.Read.Bytes+result.Write.Bytes {
+		t.Errorf("Bytes = %d includes discarded bytes", result.Bytes)
+	}
+	// ~20% discards and ~10% write-zeroes
+	if pct := float64(result.Discard.TotalIOs) / float64(result.TotalIOs); pct < 0.15 || pct > 0.25 {
+		t.Errorf("discards are %.0f%% of I/Os, want ~20%%", pct*100)
+	}
+
+	// The discarded and zeroed blocks read back as zeroes.
+	got, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Errorf("file size changed to %d", len(got))
+	}
+	zeroed := 0
+	for i := 0; i < len(got); i += 4096 {
+		if got[i] == 0 {
+			zeroed++
+		}
+	}
+	if zeroed == 0 {
+		t.Errorf("no blocks were discarded")
+	}
+
+	bad := []Params{
+		{EngineType: "uring", DiscardPct: 10},
+		{EngineType: "sync", DiscardPct: 60, WriteZeroesPct: 50},
+		{EngineType: "sync", DiscardPct: 10, Verify: "inline"},
+	}
+	for _, p := range bad {
+		p.Path = tmpFile.Name()
+		p.BlockSize = 4096
+		p.Workers = 1
+		if _, err := mustNew(t, p.EngineType).Run(context.Background(), p); err == nil {
+			t.Errorf("%+v: expected an error", p)
+		}
+	}
+}
+
+func TestEngineRunCancel(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring", "libaio", "sim"} {
+		params := Params{
+			EngineType: engineType,
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    100,
+			Rand:       true,
+			Workers:    2,
+			QueueDepth: 4,
+			MinRuntime: time.Hour,
+			MaxRuntime: time.Hour,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		start := time.Now()
+		result, err := mustNew(t, engineType).Run(ctx, params)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: err = %v, want the context's error", engineType, err)
+			continue
+		}
+		if wall := time.Since(start); wall > 2*time.Second {
+			t.Errorf("%s: took %v to stop", engineType, wall)
+		}
+		if result == nil || result.TerminationReason != "Cancelled" || result.TotalIOs == 0 {
+			t.Errorf("%s: partial result = %+v, want the I/Os so far", engineType, result)
+		}
+	}
+}
+
+func TestEngineRunLatencySplit(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-slat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring", "libaio"} {
+		params := Params{
+			EngineType:  engineType,
+			Path:        tmpFile.Name(),
+			BlockSize:   4096,
+			ReadPct:     50,
+			Rand:        true,
+			Workers:     2,
+			QueueDepth:  16,
+			SubmitBatch: 4,
+			MinRuntime:  200 * time.Millisecond,
+			MaxRuntime:  200 * time.Millisecond,
+		}
+		if engineType != "uring" {
+			params.SubmitBatch = 0
+		}
+		res, err := mustNew(t, engineType).Run(context.Background(), params)
+		if err != nil {
+			t.Logf("%s: skipping, run failed: %v", engineType, err)
+			continue
+		}
+		if engineType == "sync" {
+			if res.Slat.TotalIOs != 0 || res.Clat.TotalIOs != 0 {
+				t.Errorf("sync: split latency of %d/%d I/Os", res.Slat.TotalIOs, res.Clat.TotalIOs)
+			}
+			continue
+		}
+		if res.Slat.TotalIOs != res.TotalIOs || res.Clat.TotalIOs != res.TotalIOs {
+			t.Errorf("%s: slat of %d and clat of %d I/Os, want %d", engineType, res.Slat.TotalIOs, res.Clat.TotalIOs, res.TotalIOs)
+		}
+		// Each part is truncated to whole µs on its own.
+		sum := res.Slat.MeanLatency + res.Clat.MeanLatency
+		if diff := res.MeanLatency - sum; diff < -time.Microsecond || diff > 2*time.Microsecond+res.MeanLatency/20 {
+			t.Errorf("%s: slat %v + clat %v, total %v", engineType, res.Slat.MeanLatency, res.Clat.MeanLatency, res.MeanLatency)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncOpenFlag returns the open(2) flag selected by Params.SyncMode.
+func syncOpenFlag(mode string) (int, error) {
+	switch mode {
+	case "":
+		return 0, nil
+	case "dsync":
+		return unix.O_DSYNC, nil
+	case "sync":
+		return unix.O_SYNC, nil
+	}
+	return 0, fmt.Errorf("invalid sync mode %q (want \"dsync\" or \"sync\")", mode)
+}
+
+// checkFlush validates the flush settings of params. Engines that can't
+// issue flushes pass canFlush=false to reject FsyncEvery.
+func checkFlush(params Params, engineType string, canFlush bool) error {
+	if _, err := syncOpenFlag(params.SyncMode); err != nil {
+		return err
+	}
+	if params.FsyncEvery < 0 {
+		return fmt.Errorf("invalid fsync interval: %d", params.FsyncEvery)
+	}
+	if params.FsyncEvery > 0 && !canFlush {
+		return fmt.Errorf("fsync is not supported by the %s engine", engineType)
+	}
+	if params.Fdatasync && params.FsyncEvery == 0 {
+		return fmt.Errorf("fdatasync needs an fsync interval")
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Group is one of the workloads of a run with Params.Groups. Zero fields
+// take their value from the enclosing Params; ReadPct and Rand are pointers
+// so that a group can ask for all writes or sequential I/O explicitly.
+type Group struct {
+	Name string `yaml:"name"`
+
+	// A background group only provides load: it runs until the other groups
+	// stop, and its own convergence doesn't count.
+	Background bool `yaml:"background,omitempty"`
+
+	ReadPct      *int    `yaml:"read_pct,omitempty" json:",omitempty"`
+	Rand         *bool   `yaml:"rand,omitempty" json:",omitempty"`
+	BlockSize    int     `yaml:"block_size,omitempty"`
+	BSSplit      string  `yaml:"bssplit,omitempty"`
+	Distribution string  `yaml:"distribution,omitempty"`
+	Offset       int64   `yaml:"offset,omitempty"`
+	Length       int64   `yaml:"length,omitempty"`
+	Workers      int     `yaml:"workers,omitempty"`
+	QueueDepth   int     `yaml:"queue_depth,omitempty"`
+	TargetIOPS   float64 `yaml:"target_iops,omitempty"`
+	Arrival      string  `yaml:"arrival,omitempty"`
+}
+
+// GroupParams returns the Params of one group of p.
+func (p Params) GroupParams(g Group) Params {
+	p.Groups = nil
+	if g.ReadPct != nil {
+		p.ReadPct = *g.ReadPct
+	}
+	if g.Rand != nil {
+		p.Rand = *g.Rand
+	}
+	if g.BlockSize > 0 {
+		p.BlockSize = g.BlockSize
+	}
+	if g.BSSplit != "" {
+		p.BSSplit = g.BSSplit
+	}
+	if g.Distribution != "" {
+		p.Distribution = g.Distribution
+	}
+	if g.Offset > 0 {
+		p.Offset = g.Offset
+	}
+	if g.Length > 0 {
+		p.Length = g.Length
+	}
+	if g.Workers > 0 {
+		p.Workers = g.Workers
+	}
+	if g.QueueDepth > 0 {
+		p.QueueDepth = g.QueueDepth
+	}
+	if g.TargetIOPS > 0 {
+		p.TargetIOPS = g.TargetIOPS
+	}
+	if g.Arrival != "" {
+		p.Arrival = g.Arrival
+	}
+	return p
+}
+
+// checkGroups validates Params.Groups.
+func checkGroups(params Params) error {
+	names := make(map[string]bool)
+	foreground := false
+	for _, g := range params.Groups {
+		if g.Name == "" || strings.Contains(g.Name, ".") {
+			return fmt.Errorf("invalid group name %q (must be non-empty, without dots)", g.Name)
+		}
+		if names[g.Name] {
+			return fmt.Errorf("group %q defined twice", g.Name)
+		}
+		names[g.Name] = true
+		if g.ReadPct != nil && (*g.ReadPct < 0 || *g.ReadPct > 100) {
+			return fmt.Errorf("group %q: invalid read percentage %d", g.Name, *g.ReadPct)
+		}
+		foreground = foreground || !g.Background
+	}
+	if !foreground {
+		return fmt.Errorf("all groups are background groups; nothing would stop the run")
+	}
+	if params.Verify != "" {
+		// Each group would only know about its own writes.
+		return fmt.Errorf("verify can't be combined with groups")
+	}
+	return nil
+}
+
+// runGroups runs the groups of params on eng at once. The run stops when the
+// first foreground group does, converged or timed out, and the others are
+// stopped with it, so all groups are measured over about the same window.
+// The result has the totals of all groups and each group's own result in
+// Result.Groups. Progress and trace spans come from the first foreground
+// group only.
+func runGroups(ctx context.Context, eng Engine, params Params) (*Result, error) {
+	if err := checkGroups(params); err != nil {
+		return nil, err
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	type groupRun struct {
+		res *Result
+		err error
+	}
+	runs := make([]groupRun, len(params.Groups))
+	lead := -1 // The group that stopped the run
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	reporting := false
+	for i, g := range params.Groups {
+		p := params.GroupParams(g)
+		if g.Background {
+			p.MinRuntime, p.MaxRuntime = math.MaxInt64, 0
+		}
+		if g.Background || reporting {
+			p.Progress, p.TraceChannel = nil, nil
+		} else {
+			reporting = true
+		}
+		wg.Add(1)
+		go func(i int, p Params) {
+			defer wg.Done()
+			res, err := eng.Run(runCtx, p)
+			mu.Lock()
+			runs[i] = groupRun{res, err}
+			if lead < 0 {
+				lead = i
+			}
+			mu.Unlock()
+			stop()
+		}(i, p)
+	}
+	wg.Wait()
+
+	// The groups stopped by the lead, or by ctx, return runCtx.Err().
+	rs := make([]*Result, len(runs))
+	for i, run := range runs {
+		if run.err != nil && (run.res == nil || run.err != runCtx.Err()) {
+			return nil, fmt.Errorf("group %q: %w", params.Groups[i].Name, run.err)
+		}
+		rs[i] = run.res
+	}
+	res, err := sumGroups(params.Groups, rs, lead)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		res.TerminationReason = "Cancelled"
+		return res, ctx.Err()
+	}
+	leader := params.Groups[lead].Name
+	res.TerminationReason = leader + ": " + rs[lead].TerminationReason
+	for i, r := range rs {
+		if i != lead {
+			r.TerminationReason = "Stopped with " + leader
+		}
+	}
+	return res, nil
+}
+
+// sumGroups combines the results of groups that ran at once into the result
+// of the whole run. Rates add up; the window, CPU and device statistics are
+// those of lead, as the groups share the process and the device. The group
+// results keep their own counters and latencies, but not CPU and device
+// statistics, which would describe all groups.
+func sumGroups(groups []Group, rs []*Result, lead int) (*Result, error) {
+	res := &Result{
+		Duration: rs[lead].Duration,
+		Device:   rs[lead].Device,
+		Groups:   make(map[string]*Result, len(rs)),
+	}
+	for i, r := range rs {
+		res.TotalIOs += r.TotalIOs
+		res.Bytes += r.Bytes
+		res.IOPS += r.IOPS
+		res.Throughput += r.Throughput
+		res.OfferedIOPS += r.OfferedIOPS
+		for _, stats := range dirStatsOf {
+			d, s := stats(res), stats(r)
+			d.TotalIOs += s.TotalIOs
+			d.Bytes += s.Bytes
+			d.IOPS += s.IOPS
+			d.Throughput += s.Throughput
+		}
+		if !groups[i].Background {
+			res.MetricConfidence = max(res.MetricConfidence, r.MetricConfidence)
+		}
+		res.Groups[groups[i].Name] = r
+	}
+	c := rs[lead].CPU
+	if c.Wall > 0 {
+		res.CPU = NewCPUStats(c.User, c.Sys, c.Wall, c.SystemPct, res.TotalIOs)
+	}
+	res.Series = MergeSeries(rs...)
+	if err := MergeLatency(res, rs...); err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		r.CPU, r.Device = CPUStats{}, nil
+	}
+	return res, nil
+}
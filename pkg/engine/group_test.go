@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParamsGroup(t *testing.T) {
+	base := Params{ReadPct: 70, Rand: true, BlockSize: 4096, Workers: 4, QueueDepth: 32, Offset: 1 << 20}
+	base.Groups = []Group{{Name: "a"}}
+	writes, seq := 0, false
+	p := base.GroupParams(Group{Name: "writer", ReadPct: &writes, Rand: &seq, BlockSize: 1 << 20, QueueDepth: 4})
+	if p.ReadPct != 0 || p.Rand || p.BlockSize != 1<<20 || p.QueueDepth != 4 {
+		t.Errorf("overrides not applied: %+v", p)
+	}
+	if p.Workers != 4 || p.Offset != 1<<20 || p.Groups != nil {
+		t.Errorf("base not inherited: %+v", p)
+	}
+	if p := base.GroupParams(Group{Name: "probe"}); p.ReadPct != 70 || !p.Rand {
+		t.Errorf("unset pointers overrode the base: %+v", p)
+	}
+
+	bad := 101
+	for _, groups := range [][]Group{
+		{{Name: ""}},
+		{{Name: "a.b"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", ReadPct: &bad}},
+		{{Name: "a", Background: true}},
+	} {
+		if err := checkGroups(Params{Groups: groups}); err == nil {
+			t.Errorf("%+v accepted", groups)
+		}
+	}
+	if err := checkGroups(Params{Groups: []Group{{Name: "a"}}, Verify: "inline"}); err == nil {
+		t.Errorf("verify accepted")
+	}
+	if _, err := NewSim().Run(context.Background(), Params{Groups: []Group{{Name: "a"}}}); err == nil {
+		t.Errorf("sim accepted groups")
+	}
+}
+
+func TestEngineRunGroups(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(4 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	writes, seq := 0, false
+	for _, engineType := range []string{"sync", "uring", "libaio"} {
+		params := Params{
+			EngineType: engineType,
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    100,
+			Rand:       true,
+			Workers:    1,
+			QueueDepth: 1,
+			MinRuntime: 300 * time.Millisecond,
+			MaxRuntime: 300 * time.Millisecond,
+			Groups: []Group{
+				{Name: "probe"},
+				{Name: "writer", Background: true, ReadPct: &writes, Rand: &seq, BlockSize: 65536, Workers: 2, QueueDepth: 4, Offset: 2 << 20},
+			},
+		}
+		res, err := mustNew(t, engineType).Run(context.Background(), params)
+		if err != nil {
+			t.Logf("%s: skipping, run failed: %v", engineType, err)
+			continue
+		}
+		probe, writer := res.Groups["probe"], res.Groups["writer"]
+		if probe == nil || writer == nil {
+			t.Fatalf("%s: groups %v", engineType, res.Groups)
+		}
+		if probe.Read.TotalIOs == 0 || probe.Write.TotalIOs != 0 || writer.Write.TotalIOs == 0 || writer.Read.TotalIOs != 0 {
+			t.Errorf("%s: probe did %d/%d, writer %d/%d reads/writes", engineType, probe.Read.TotalIOs, probe.Write.TotalIOs, writer.Read.TotalIOs, writer.Write.TotalIOs)
+		}
+		if writer.Bytes != writer.TotalIOs*65536 {
+			t.Errorf("%s: writer moved %d bytes in %d I/Os", engineType, writer.Bytes, writer.TotalIOs)
+		}
+		if res.TotalIOs != probe.TotalIOs+writer.TotalIOs || res.Write.TotalIOs != writer.Write.TotalIOs {
+			t.Errorf("%s: totals %d, groups %d + %d", engineType, res.TotalIOs, probe.TotalIOs, writer.TotalIOs)
+		}
+		// The probe timed out and stopped the writer with it.
+		if !strings.HasPrefix(res.TerminationReason, "probe: ") || writer.TerminationReason != "Stopped with probe" {
+			t.Errorf("%s: reasons %q, %q", engineType, res.TerminationReason, writer.TerminationReason)
+		}
+		if d := writer.Duration - probe.Duration; d < -100*time.Millisecond || d > 100*time.Millisecond {
+			t.Errorf("%s: probe ran %v, writer %v", engineType, probe.Duration, writer.Duration)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Latency histograms record values in microseconds, from 1µs up to one hour,
+// with 3 significant digits.
+const (
+	histMinValue = 1
+	histMaxValue = 3600000000
+	histSigFigs  = 3
+)
+
+// NewHistogram returns an empty latency histogram with the bounds used by every
+// engine, so histograms from different sources can be merged.
+func NewHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(histMinValue, histMaxValue, histSigFigs)
+}
+
+// EncodeHistogram serializes h using the compressed HdrHistogram V2 format.
+// The output is base64 text, so it can be embedded directly in JSON.
+func EncodeHistogram(h *hdrhistogram.Histogram) (string, error) {
+	data, err := h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeHistogram is the inverse of EncodeHistogram.
+func DecodeHistogram(s string) (*hdrhistogram.Histogram, error) {
+	return hdrhistogram.Decode([]byte(s))
+}
+
+// SetLatency fills the latency fields of r from h and stores h, encoded, in
+// r.Histogram so that r can later be merged exactly with other results.
+func (r *Result) SetLatency(h *hdrhistogram.Histogram) error {
+	var d DirStats
+	if err := d.SetLatency(h); err != nil {
+		return err
+	}
+	r.Histogram = d.Histogram
+	r.MeanLatency = d.MeanLatency
+	r.P50Latency = d.P50Latency
+	r.P95Latency = d.P95Latency
+	r.P99Latency = d.P99Latency
+	r.P999Latency = d.P999Latency
+	return nil
+}
+
+// SetLatency is the DirStats counterpart of Result.SetLatency.
+func (d *DirStats) SetLatency(h *hdrhistogram.Histogram) error {
+	enc, err := EncodeHistogram(h)
+	if err != nil {
+		return fmt.Errorf("failed to encode latency histogram: %v", err)
+	}
+	d.Histogram = enc
+	d.MeanLatency = time.Duration(h.Mean() * float64(time.Microsecond))
+	d.P50Latency = time.Duration(h.ValueAtQuantile(50.0)) * time.Microsecond
+	d.P95Latency = time.Duration(h.ValueAtQuantile(95.0)) * time.Microsecond
+	d.P99Latency = time.Duration(h.ValueAtQuantile(99.0)) * time.Microsecond
+	d.P999Latency = time.Duration(h.ValueAtQuantile(99.9)) * time.Microsecond
+	return nil
+}
+
+// dirStatsOf selects each of the DirStats of a Result.
+var dirStatsOf = []func(*Result) *DirStats{
+	func(r *Result) *DirStats { return &r.Read },
+	func(r *Result) *DirStats { return &r.Write },
+	func(r *Result) *DirStats { return &r.Flush },
+	func(r *Result) *DirStats { return &r.Discard },
+	func(r *Result) *DirStats { return &r.WriteZeroes },
+	func(r *Result) *DirStats { return &r.Slat },
+	func(r *Result) *DirStats { return &r.Clat },
+}
+
+// MergeLatency recomputes the overall and per-operation latency fields of dst
+// from the combined histograms of rs. Results without a histogram are
+// skipped; fields for which no histogram exists at all are left untouched.
+func MergeLatency(dst *Result, rs ...*Result) error {
+	var all []string
+	for _, r := range rs {
+		if r != nil {
+			all = append(all, r.Histogram)
+		}
+	}
+	if h, err := mergeEncoded(all); err != nil {
+		return err
+	} else if h != nil {
+		if err := dst.SetLatency(h); err != nil {
+			return err
+		}
+	}
+
+	for _, stats := range dirStatsOf {
+		var encoded []string
+		for _, r := range rs {
+			if r != nil {
+				encoded = append(encoded, stats(r).Histogram)
+			}
+		}
+		if h, err := mergeEncoded(encoded); err != nil {
+			return err
+		} else if h != nil {
+			if err := stats(dst).SetLatency(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeEncoded decodes and combines the given histograms, skipping empty
+// strings. It returns nil if there was nothing to merge.
+func mergeEncoded(encoded []string) (*hdrhistogram.Histogram, error) {
+	var merged *hdrhistogram.Histogram
+	for _, enc := range encoded {
+		if enc == "" {
+			continue
+		}
+		h, err := DecodeHistogram(enc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode latency histogram: %v", err)
+		}
+		if merged == nil {
+			merged = NewHistogram()
+		}
+		merged.Merge(h)
+	}
+	return merged, nil
+}
@@ -1,18 +1,17 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"os"
 	"sync"
-	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
 
-	"github.com/HdrHistogram/hdrhistogram-go"
 	"golang.org/x/sys/unix"
 )
 
@@ -48,15 +47,67 @@ type ioEvent struct {
 type LibAIOEngine struct {
 }
 
+func init() {
+	Register(Registration{
+		Name:        "libaio",
+		Description: "Linux native AIO (io_submit/io_getevents)",
+		Caps:        Capabilities{Async: true, Direct: true},
+		Fio:         "libaio",
+		New:         func() Engine { return NewLibAIO() },
+		Available: func() error {
+			var ctxId uint64
+			if _, _, errno := unix.Syscall(unix.SYS_IO_SETUP, 1, uintptr(unsafe.Pointer(&ctxId)), 0); errno != 0 {
+				return errno
+			}
+			unix.Syscall(unix.SYS_IO_DESTROY, uintptr(ctxId), 0, 0)
+			return nil
+		},
+	})
+}
+
 func NewLibAIO() *LibAIOEngine {
 	return &LibAIOEngine{}
 }
 
 func (e *LibAIOEngine) NumNodes() int { return 1 }
 
-func (e *LibAIOEngine) Run(params Params) (*Result, error) {
-	if params.BlockSize <= 0 {
-		return nil, fmt.Errorf("invalid block size: %d", params.BlockSize)
+func (e *LibAIOEngine) Run(ctx context.Context, params Params) (*Result, error) {
+	if len(params.Groups) > 0 {
+		return runGroups(ctx, e, params)
+	}
+	sizes, err := newBlockSizes(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseDistribution(params.Distribution); err != nil {
+		return nil, err
+	}
+	v, err := newVerifier(params, sizes)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDiscard(params, "libaio", false); err != nil {
+		return nil, err
+	}
+	if err := checkFlush(params, "libaio", false); err != nil {
+		return nil, err
+	}
+	if err := checkData(params, "libaio", true); err != nil {
+		return nil, err
+	}
+	if err := checkThink(params, "libaio", true); err != nil {
+		return nil, err
+	}
+	if err := checkArrival(params); err != nil {
+		return nil, err
+	}
+	ctl, err := newController(params)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := newPlacer(params)
+	if err != nil {
+		return nil, err
 	}
 
 	// 1. Sanitize Inputs
@@ -76,10 +127,11 @@ func (e *LibAIOEngine) Run(params Params) (*Result, error) {
 
 	var wg sync.WaitGroup
 	done := make(chan struct{})
-	var opsCounter int64
 	results := make(chan workerResult, numWorkers)
 
-	start := time.Now()
+	// Measurement starts once the ramp is over. Workers keep issuing I/O
+	// during the ramp but don't record it.
+	start := time.Now().Add(params.RampTime)
 
 	for i := 0; i < numWorkers; i++ {
 		workerQD := qdPerWorker
@@ -89,7 +141,7 @@ func (e *LibAIOEngine) Run(params Params) (*Result, error) {
 		wg.Add(1)
 		go func(id int, qd int) {
 			defer wg.Done()
-			results <- e.runAIOWorker(id, params, qd, done, &opsCounter)
+			results <- e.runAIOWorker(id, params, sizes, v, start, qd, numWorkers, done, ctl, pl)
 		}(i, workerQD)
 	}
 
@@ -97,68 +149,19 @@ func (e *LibAIOEngine) Run(params Params) (*Result, error) {
 	monitorTicker := time.NewTicker(100 * time.Millisecond)
 	defer monitorTicker.Stop()
 
-	var iopsSamples []float64
-	var lastOps int64
-	var lastTime = start
-	var finalRelErr float64
 	var reason string
 
 	for {
 		select {
+		case <-ctx.Done():
+			reason = "Cancelled"
+			goto Finished
 		case <-monitorTicker.C:
 			now := time.Now()
-			elapsed := now.Sub(start)
-			currOps := atomic.LoadInt64(&opsCounter)
-			deltaOps := currOps - lastOps
-			deltaTime := now.Sub(lastTime).Seconds()
-			if deltaTime > 0 {
-				iopsSamples = append(iopsSamples, float64(deltaOps)/deltaTime)
-			}
-			lastOps = currOps
-			lastTime = now
-
-			var mean, stdErr float64
-			if len(iopsSamples) > 0 {
-				mean, stdErr = calculateStats(iopsSamples)
-			}
-			if mean > 0 {
-				finalRelErr = stdErr / mean
-			}
-
-			// Calculate Instantaneous IOPS (Last 10 samples = 1 second) for display
-			var instantIOPS float64
-			window := 10
-			if len(iopsSamples) == 0 {
-				instantIOPS = 0
-			} else if len(iopsSamples) < window {
-				instantIOPS = mean
-			} else {
-				sum := 0.0
-				for k := 0; k < window; k++ {
-					sum += iopsSamples[len(iopsSamples)-1-k]
-				}
-				instantIOPS = sum / float64(window)
-			}
-
-			if params.Progress != nil {
-				params.Progress(Result{
-					IOPS:             instantIOPS,
-					MetricConfidence: finalRelErr,
-					Duration:         elapsed,
-					TotalIOs:         currOps,
-				})
-			}
-
-			if elapsed > params.MinRuntime {
-				if len(iopsSamples) > 5 && mean > 0 && params.ErrorTarget > 0 {
-					if finalRelErr <= params.ErrorTarget {
-						reason = "Converged"
-						goto Finished
-					}
-				}
+			if now.Before(start) {
+				continue // Still ramping
 			}
-			if params.MaxRuntime > 0 && elapsed >= params.MaxRuntime {
-				reason = "Timeout"
+			if reason = ctl.tick(now.Sub(start)); reason != "" {
 				goto Finished
 			}
 		}
@@ -167,21 +170,35 @@ func (e *LibAIOEngine) Run(params Params) (*Result, error) {
 Finished:
 	close(done)
 	wg.Wait()
+	cpu := ctl.cpu()
+	dev := ctl.device()
 	close(results)
 
 	duration := time.Since(start)
 	
 	syncEng := &SyncEngine{}
-	res, err := syncEng.aggregate(results, duration, finalRelErr)
+	res, err := syncEng.aggregate(results, duration, ctl.relErr)
 	if err != nil {
 		return nil, err
 	}
-	res.Throughput = float64(res.TotalIOs*int64(params.BlockSize)) / duration.Seconds()
 	res.TerminationReason = reason
+	res.Placement = pl.placement(params)
+	res.CPU = cpu
+	res.Device = dev
+	res.Series = ctl.finishSeries(duration)
+	if err := finishVerify(ctx, v, params, res); err != nil {
+		return nil, err
+	}
+	if reason == "Cancelled" {
+		return res, ctx.Err()
+	}
 	return res, nil
 }
 
-func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan struct{}, opsCounter *int64) workerResult {
+func (e *LibAIOEngine) runAIOWorker(id int, params Params, sizes blockSizes, v *verifier, measureFrom time.Time, qd int, numWorkers int, done chan struct{}, ctl *controller, pl *placer) workerResult {
+	if err := pl.pin(id); err != nil {
+		return workerResult{err: err}
+	}
 	flags := os.O_RDONLY
 	if params.ReadPct < 100 {
 		flags = os.O_RDWR
@@ -189,6 +206,8 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 	if params.Direct {
 		flags |= syscall.O_DIRECT
 	}
+	syncFlag, _ := syncOpenFlag(params.SyncMode)
+	flags |= syncFlag
 
 	f, err := os.OpenFile(params.Path, flags, 0666)
 	if err != nil {
@@ -205,10 +224,10 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 		unix.Syscall(unix.SYS_IO_DESTROY, uintptr(ctxId), 0, 0)
 	}()
 
-	totalBufSize := params.BlockSize * qd
-	alignedBlock, err := unix.Mmap(-1, 0, totalBufSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	totalBufSize := sizes.max * qd
+	alignedBlock, err := pl.mmap(totalBufSize)
 	if err != nil {
-		return workerResult{err: fmt.Errorf("failed to allocate aligned memory: %v", err)}
+		return workerResult{err: err}
 	}
 	defer unix.Munmap(alignedBlock)
 
@@ -217,14 +236,14 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 		return workerResult{err: err}
 	}
 	
-	maxBlocks := size / int64(params.BlockSize)
-	if maxBlocks <= 0 {
-		return workerResult{err: fmt.Errorf("file too small for block size")}
+	rg, err := workerRegion(params, sizes, size, id, numWorkers)
+	if err != nil {
+		return workerResult{err: err}
 	}
 
 	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
-	var ioCount int64
-	hist := hdrhistogram.New(1, 3600000000, 3)
+	gen := newDataGen(params, qd, r.Int63())
+	wr := newWorkerResult()
 
 	freeSlots := make([]int, qd)
 	for i := 0; i < qd; i++ {
@@ -233,8 +252,19 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 	nextFreeIdx := qd
 	
 	startTimes := make([]time.Time, qd)
+	submitTimes := make([]time.Time, qd)
+	intendedTimes := make([]time.Time, qd)
+	slotIsRead := make([]bool, qd)
+	slotOffset := make([]int64, qd)
+	slotSeq := make([]uint64, qd)
+	slotBuf := make([][]byte, qd)
 	inFlight := 0
-	lastOffset := r.Int63n(maxBlocks) * int64(params.BlockSize)
+	offsets, err := newOffsetGen(params, rg, r.Int63n(rg.blocks), r)
+	if err != nil {
+		return workerResult{err: err}
+	}
+	pace := newPacer(params, id, numWorkers, time.Now(), r)
+	th := newThinker(params, r)
 	
 	events := make([]ioEvent, qd)
 	iocbs := make([]iocb, qd)
@@ -243,46 +273,74 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 	var traceSpans []Span
 	const traceBatchSize = 1000
 
+	finish := func() workerResult {
+		if pace != nil {
+			wr.offered += pace.Due(time.Now())
+		}
+		if params.TraceChannel != nil && len(traceSpans) > 0 {
+			params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: math.MaxInt64}
+		}
+		return wr
+	}
+
 	for {
 		submitCount := 0
 		// Fill slots
 		for inFlight < qd && nextFreeIdx > 0 {
+			if pace != nil && pace.Peek().After(time.Now()) {
+				break
+			}
+			if !th.ready(time.Now(), inFlight) {
+				break
+			}
 			nextFreeIdx--
 			slotIdx := freeSlots[nextFreeIdx]
 
-			offset := int64(0)
-			if params.Rand {
-				offset = r.Int63n(maxBlocks) * int64(params.BlockSize)
-			} else {
-				offset = lastOffset
-				lastOffset = (lastOffset + int64(params.BlockSize)) % size
-			}
+			// checkDiscard leaves only reads and writes.
+			isRead := pickOp(params, r) == opRead
 
-			isRead := true
-			if params.ReadPct < 100 {
-				if params.ReadPct == 0 || r.Intn(100) >= params.ReadPct {
-					isRead = false
-				}
-			}
+			slotStart := slotIdx * sizes.max
+			blockBuf := alignedBlock[slotStart : slotStart+sizes.pick(isRead, r)]
+			offset := offsets.Next(len(blockBuf))
+			prepStart := time.Now()
+			gen.prepare(blockBuf, slotIdx, isRead)
 
 			cb := &iocbs[slotIdx]
 			*cb = iocb{}
 			cb.Fd = uint32(f.Fd())
 			cb.Data = uint64(slotIdx)
-			cb.Buf = uint64(uintptr(unsafe.Pointer(&alignedBlock[slotIdx*params.BlockSize])))
-			cb.NBytes = uint64(params.BlockSize)
+			cb.Buf = uint64(uintptr(unsafe.Pointer(&blockBuf[0])))
+			cb.NBytes = uint64(len(blockBuf))
 			cb.Offset = offset
 			
 			if isRead {
 				cb.OpCode = IOCB_CMD_PREAD
+				if v != nil {
+					slotSeq[slotIdx] = v.reading(offset)
+				}
 			} else {
 				cb.OpCode = IOCB_CMD_PWRITE
+				if v != nil {
+					slotSeq[slotIdx] = v.fill(blockBuf, offset)
+				}
 			}
 
 			iocbPtrs[submitCount] = cb
 			startTimes[slotIdx] = time.Now()
+			if pace != nil {
+				intended := pace.Next()
+				if !intended.Before(measureFrom) {
+					wr.offered++
+				}
+				// Generating the data isn't part of the I/O's latency.
+				intendedTimes[slotIdx] = intended.Add(startTimes[slotIdx].Sub(prepStart))
+			}
+			slotIsRead[slotIdx] = isRead
+			slotOffset[slotIdx] = offset
+			slotBuf[slotIdx] = blockBuf
 			submitCount++
 			inFlight++
+			th.issued(startTimes[slotIdx])
 		}
 
 		if submitCount > 0 {
@@ -293,16 +351,47 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 			if int(nSub) != submitCount {
 				return workerResult{err: fmt.Errorf("io_submit submitted %d < %d", nSub, submitCount)}
 			}
+			now := time.Now()
+			for _, cb := range iocbPtrs[:submitCount] {
+				submitTimes[cb.Data] = now
+			}
+		}
+
+		if pace != nil && inFlight == 0 {
+			if !sleepUntil(pace.Peek(), params.SpinWait, done) {
+				return finish()
+			}
+			continue
+		}
+		if th != nil && inFlight == 0 {
+			if !sleepUntil(th.next, params.SpinWait, done) {
+				return finish()
+			}
+			continue
 		}
 
 		minNr := 0
+		var timeout *unix.Timespec
 		if inFlight == qd {
 			minNr = 1
+		} else if pace != nil {
+			// Wait for a completion, but no longer than the next arrival.
+			minNr = 1
+			ts := unix.NsecToTimespec(int64(max(time.Until(pace.Peek()), 0)))
+			timeout = &ts
+		} else if th != nil {
+			// Likewise while thinking; at the end of a burst, wait for the
+			// I/Os still in flight.
+			minNr = 1
+			if !th.draining() {
+				ts := unix.NsecToTimespec(int64(max(time.Until(th.next), 0)))
+				timeout = &ts
+			}
 		}
 		
 		if inFlight > 0 {
 			// io_getevents
-			nEvt, _, errno := unix.Syscall6(unix.SYS_IO_GETEVENTS, uintptr(ctxId), uintptr(minNr), uintptr(qd), uintptr(unsafe.Pointer(&events[0])), 0, 0)
+			nEvt, _, errno := unix.Syscall6(unix.SYS_IO_GETEVENTS, uintptr(ctxId), uintptr(minNr), uintptr(qd), uintptr(unsafe.Pointer(&events[0])), uintptr(unsafe.Pointer(timeout)), 0)
 			if errno != 0 && errno != syscall.EINTR {
 				return workerResult{err: fmt.Errorf("io_getevents failed: %v", errno)}
 			}
@@ -319,15 +408,27 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 				ioStart := startTimes[slotIdx]
 				startTimes[slotIdx] = time.Time{}
 
-				_ = hist.RecordValue(ioEnd.Sub(ioStart).Microseconds())
-				ioCount++
-				atomic.AddInt64(opsCounter, 1)
+				latStart := ioStart
+				if pace != nil {
+					latStart = intendedTimes[slotIdx]
+				}
+				ramping := ioEnd.Before(measureFrom)
+				if !ramping {
+					us := ioEnd.Sub(latStart).Microseconds()
+					wr.record(slotIsRead[slotIdx], us, int(evt.Res))
+					wr.recordSplit(ioStart, submitTimes[slotIdx], ioEnd)
+					ctl.record(us, int64(evt.Res))
+				}
+				if v != nil {
+					v.completed(slotBuf[slotIdx], slotIsRead[slotIdx], slotOffset[slotIdx], slotSeq[slotIdx])
+				}
+				th.completed(ioEnd)
 				inFlight--
 
 				freeSlots[nextFreeIdx] = slotIdx
 				nextFreeIdx++
 
-				if params.TraceChannel != nil {
+				if params.TraceChannel != nil && !ramping {
 					traceSpans = append(traceSpans, Span{Start: ioStart.UnixNano(), End: ioEnd.UnixNano()})
 				}
 			}
@@ -349,10 +450,7 @@ func (e *LibAIOEngine) runAIOWorker(id int, params Params, qd int, done chan str
 
 		select {
 		case <-done:
-			if params.TraceChannel != nil && len(traceSpans) > 0 {
-				params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: math.MaxInt64}
-			}
-			return workerResult{ioCount: ioCount, hist: hist}
+			return finish()
 		default:
 		}
 	}
@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Random offset distributions, selected by Params.Distribution using fio's
+// random_distribution syntax:
+//
+//	uniform                 every block equally likely (default)
+//	zipf:<theta>            Zipf with exponent theta (e.g. zipf:0.99, zipf:1.2)
+//	pareto:<h>              fraction h of I/O goes to fraction 1-h of the space
+//	normal:<dev>            Gaussian around the middle, stddev in % of the space
+//	zoned:<io%>/<space%>:…  piecewise hot set, e.g. zoned:80/10:20/90
+//
+// For zipf, pareto and zoned the hottest blocks are at the start of the range.
+type distribution struct {
+	kind  string
+	arg   float64
+	zones []zone
+}
+
+// zone is one piece of a zoned distribution.
+type zone struct {
+	ioPct    float64
+	spacePct float64
+}
+
+func parseDistribution(spec string) (distribution, error) {
+	if spec == "" || spec == "uniform" || spec == "random" {
+		return distribution{kind: "uniform"}, nil
+	}
+
+	kind, arg, _ := strings.Cut(spec, ":")
+	d := distribution{kind: kind}
+	switch kind {
+	case "zipf", "pareto", "normal":
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return d, fmt.Errorf("invalid %s parameter %q: %v", kind, arg, err)
+		}
+		d.arg = v
+		switch {
+		case kind == "zipf" && v <= 0:
+			return d, fmt.Errorf("zipf theta must be > 0, got %g", v)
+		case kind == "pareto" && (v <= 0 || v >= 1):
+			return d, fmt.Errorf("pareto h must be in (0, 1), got %g", v)
+		case kind == "normal" && v <= 0:
+			return d, fmt.Errorf("normal deviation must be > 0, got %g", v)
+		}
+	case "zoned":
+		var ioSum, spaceSum float64
+		for _, part := range strings.Split(arg, ":") {
+			ioStr, spaceStr, ok := strings.Cut(part, "/")
+			if !ok {
+				return d, fmt.Errorf("invalid zone %q (want <io%%>/<space%%>)", part)
+			}
+			io, err1 := strconv.ParseFloat(ioStr, 64)
+			space, err2 := strconv.ParseFloat(spaceStr, 64)
+			if err1 != nil || err2 != nil || io < 0 || space <= 0 {
+				return d, fmt.Errorf("invalid zone %q", part)
+			}
+			d.zones = append(d.zones, zone{ioPct: io, spacePct: space})
+			ioSum += io
+			spaceSum += space
+		}
+		if math.Abs(ioSum-100) > 1e-6 || math.Abs(spaceSum-100) > 1e-6 {
+			return d, fmt.Errorf("zoned percentages must each sum to 100 (got io=%g, space=%g)", ioSum, spaceSum)
+		}
+	default:
+		return d, fmt.Errorf("unknown distribution %q", spec)
+	}
+	return d, nil
+}
+
+// region is the part of the target a worker issues I/O to.
+type region struct {
+	base   int64 // Byte offset of block 0
+	blocks int64
+	unit   int64 // Block size, i.e. offset alignment
+}
+
+// end returns the byte offset just past the region.
+func (rg region) end() int64 {
+	return rg.base + rg.blocks*rg.unit
+}
+
+// workerRegion works out the region for worker id of numWorkers on a target
+// of size bytes, from Params.Offset, Length, WorkingSet and Disjoint.
+func workerRegion(params Params, sizes blockSizes, size int64, id, numWorkers int) (region, error) {
+	bs := int64(sizes.align)
+	if params.Offset < 0 || params.Length < 0 || params.WorkingSet < 0 {
+		return region{}, fmt.Errorf("offset, length and working set must not be negative")
+	}
+	if params.Offset%bs != 0 {
+		return region{}, fmt.Errorf("offset %d is not a multiple of the block size %d", params.Offset, bs)
+	}
+	if params.Offset >= size {
+		return region{}, fmt.Errorf("offset %d is beyond the end of the target (%d bytes)", params.Offset, size)
+	}
+
+	length := size - params.Offset
+	if params.Length > 0 && params.Length < length {
+		length = params.Length
+	}
+	if params.WorkingSet > 0 && params.WorkingSet < length {
+		length = params.WorkingSet
+	}
+	rg := region{base: params.Offset, blocks: length / bs, unit: bs}
+
+	if params.Disjoint && numWorkers > 1 {
+		per := rg.blocks / int64(numWorkers)
+		if per == 0 {
+			return region{}, fmt.Errorf("region of %d blocks too small to split across %d workers", rg.blocks, numWorkers)
+		}
+		rg.base += int64(id) * per * bs
+		rg.blocks = per
+	}
+	if rg.blocks <= 0 || rg.blocks*bs < int64(sizes.max) {
+		return region{}, fmt.Errorf("file too small for block size")
+	}
+	return rg, nil
+}
+
+// offsetGen picks block-aligned offsets for a worker. Each worker owns one,
+// since it is not safe for concurrent use.
+type offsetGen struct {
+	rand      bool
+	blockSize int64 // Alignment unit
+	base      int64
+	end       int64
+	maxBlocks int64
+	next      int64 // next block for sequential I/O
+	r         *rand.Rand
+	dist      distribution
+
+	zipf  *zipfGen
+	gzipf *rand.Zipf // used for theta > 1
+}
+
+// newOffsetGen creates a generator over the blocks of rg. Sequential I/O
+// starts at block seqStart of the region and wraps around.
+func newOffsetGen(params Params, rg region, seqStart int64, r *rand.Rand) (*offsetGen, error) {
+	maxBlocks := rg.blocks
+	dist, err := parseDistribution(params.Distribution)
+	if err != nil {
+		return nil, err
+	}
+	g := &offsetGen{
+		rand:      params.Rand,
+		blockSize: rg.unit,
+		base:      rg.base,
+		end:       rg.end(),
+		maxBlocks: maxBlocks,
+		next:      seqStart % maxBlocks,
+		r:         r,
+		dist:      dist,
+	}
+	if dist.kind == "zipf" && g.rand {
+		if dist.arg > 1 {
+			g.gzipf = rand.NewZipf(r, dist.arg, 1, uint64(maxBlocks-1))
+		} else {
+			g.zipf = newZipfGen(maxBlocks, dist.arg)
+		}
+	}
+	return g, nil
+}
+
+// Next returns the byte offset of the next I/O, which is size bytes long and
+// must fit in the region.
+func (g *offsetGen) Next(size int) int64 {
+	n := int64(size)
+	if !g.rand {
+		off := g.base + g.next*g.blockSize
+		if off+n > g.end {
+			off = g.base
+			g.next = 0
+		}
+		g.next = (g.next + (n+g.blockSize-1)/g.blockSize) % g.maxBlocks
+		return off
+	}
+	off := g.base + g.block()*g.blockSize
+	if off+n > g.end {
+		off = g.end - n
+	}
+	return off
+}
+
+func (g *offsetGen) block() int64 {
+	n := g.maxBlocks
+	switch g.dist.kind {
+	case "zipf":
+		if g.gzipf != nil {
+			return int64(g.gzipf.Uint64())
+		}
+		return g.zipf.next(g.r)
+	case "pareto":
+		// Power law CDF F(x) = x^a over the unit interval, with a chosen so
+		// that F(1-h) = h.
+		a := math.Log(g.dist.arg) / math.Log(1-g.dist.arg)
+		x := math.Pow(g.r.Float64(), 1/a)
+		return clampBlock(int64(x*float64(n)), n)
+	case "normal":
+		stddev := g.dist.arg / 100 * float64(n)
+		for {
+			b := int64(float64(n)/2 + g.r.NormFloat64()*stddev)
+			if b >= 0 && b < n {
+				return b
+			}
+		}
+	case "zoned":
+		u := g.r.Float64() * 100
+		var ioAcc, spaceAcc float64
+		for i, z := range g.dist.zones {
+			ioAcc += z.ioPct
+			if u < ioAcc || i == len(g.dist.zones)-1 {
+				lo := int64(spaceAcc / 100 * float64(n))
+				hi := int64((spaceAcc + z.spacePct) / 100 * float64(n))
+				if hi <= lo {
+					hi = lo + 1
+				}
+				return clampBlock(lo+g.r.Int63n(hi-lo), n)
+			}
+			spaceAcc += z.spacePct
+		}
+	}
+	return g.r.Int63n(n)
+}
+
+func clampBlock(b, n int64) int64 {
+	if b < 0 {
+		return 0
+	}
+	if b >= n {
+		return n - 1
+	}
+	return b
+}
+
+// zipfGen draws Zipf-distributed ranks in [0, n) for 0 < theta <= 1 using the
+// method from Gray et al., "Quickly Generating Billion-Record Synthetic
+// Databases". rand.Zipf only covers exponents > 1.
+type zipfGen struct {
+	n     float64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+func newZipfGen(n int64, theta float64) *zipfGen {
+	if theta == 1 {
+		// The closed form below is singular at exactly 1.
+		theta = 1 - 1e-6
+	}
+	zetan := zeta(n, theta)
+	zeta2 := zeta(2, theta)
+	return &zipfGen{
+		n:     float64(n),
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta2/zetan),
+	}
+}
+
+func (z *zipfGen) next(r *rand.Rand) int64 {
+	u := r.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	return clampBlock(int64(z.n*math.Pow(z.eta*u-z.eta+1, z.alpha)), int64(z.n))
+}
+
+// zeta computes sum_{i=1..n} i^-theta. Large devices have billions of
+// blocks, so past the first terms the sum is approximated by its integral.
+func zeta(n int64, theta float64) float64 {
+	const exact = 10000
+	sum := 0.0
+	m := n
+	if m > exact {
+		m = exact
+	}
+	for i := int64(1); i <= m; i++ {
+		sum += math.Pow(float64(i), -theta)
+	}
+	if n > m {
+		lo, hi := float64(m)+0.5, float64(n)+0.5
+		sum += (math.Pow(hi, 1-theta) - math.Pow(lo, 1-theta)) / (1 - theta)
+	}
+	return sum
+}
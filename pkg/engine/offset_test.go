@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseDistribution(t *testing.T) {
+	valid := []string{"", "uniform", "zipf:0.99", "zipf:1.2", "pareto:0.8", "normal:10", "zoned:80/10:20/90"}
+	for _, spec := range valid {
+		if _, err := parseDistribution(spec); err != nil {
+			t.Errorf("parseDistribution(%q) failed: %v", spec, err)
+		}
+	}
+
+	invalid := []string{"zipfian", "zipf:x", "zipf:0", "pareto:1", "normal:-1", "zoned:80/10", "zoned:80/10:20"}
+	for _, spec := range invalid {
+		if _, err := parseDistribution(spec); err == nil {
+			t.Errorf("parseDistribution(%q) should have failed", spec)
+		}
+	}
+}
+
+// hotFraction returns the fraction of generated offsets that fall into the
+// first pct percent of the blocks.
+func hotFraction(t *testing.T, spec string, pct float64) float64 {
+	const maxBlocks = 100000
+	const samples = 200000
+	params := Params{BlockSize: 4096, Rand: true, Distribution: spec}
+	g, err := newOffsetGen(params, region{blocks: maxBlocks, unit: 4096}, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := int64(pct / 100 * maxBlocks * 4096)
+	hot := 0
+	for i := 0; i < samples; i++ {
+		off := g.Next(4096)
+		if off < 0 || off >= maxBlocks*4096 || off%4096 != 0 {
+			t.Fatalf("%s: offset %d out of range or unaligned", spec, off)
+		}
+		if off < limit {
+			hot++
+		}
+	}
+	return float64(hot) / samples
+}
+
+func TestOffsetDistributions(t *testing.T) {
+	tests := []struct {
+		spec     string
+		pct      float64
+		min, max float64
+	}{
+		{"uniform", 10, 0.08, 0.12},
+		{"zoned:80/10:20/90", 10, 0.78, 0.82},
+		{"pareto:0.8", 20, 0.78, 0.82},
+		{"zipf:0.99", 10, 0.7, 1.0},
+		{"zipf:1.2", 10, 0.9, 1.0},
+	}
+	for _, tt := range tests {
+		got := hotFraction(t, tt.spec, tt.pct)
+		if got < tt.min || got > tt.max {
+			t.Errorf("%s: %.3f of I/O in first %.0f%%, want [%.2f, %.2f]", tt.spec, got, tt.pct, tt.min, tt.max)
+		}
+	}
+}
+
+func TestOffsetSequentialWraps(t *testing.T) {
+	g, err := newOffsetGen(Params{BlockSize: 512}, region{blocks: 3, unit: 512}, 2, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{1024, 0, 512, 1024}
+	for i, w := range want {
+		if got := g.Next(512); got != w {
+			t.Errorf("Next() #%d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestWorkerRegion(t *testing.T) {
+	const size = 1 << 20
+	tests := []struct {
+		name   string
+		params Params
+		id     int
+		want   region
+	}{
+		{"whole", Params{BlockSize: 4096}, 0, region{0, 256, 4096}},
+		{"offset", Params{BlockSize: 4096, Offset: 65536}, 0, region{65536, 240, 4096}},
+		{"length", Params{BlockSize: 4096, Offset: 65536, Length: 8192}, 0, region{65536, 2, 4096}},
+		{"working set", Params{BlockSize: 4096, Length: 65536, WorkingSet: 16384}, 0, region{0, 4, 4096}},
+		{"disjoint", Params{BlockSize: 4096, Offset: 4096, Length: 40960, Disjoint: true}, 3, region{4096 + 3*8192, 2, 4096}},
+	}
+	for _, tt := range tests {
+		sizes, _ := newBlockSizes(tt.params)
+		got, err := workerRegion(tt.params, sizes, size, tt.id, 4)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, p := range []Params{
+		{BlockSize: 4096, Offset: 100},
+		{BlockSize: 4096, Offset: size},
+		{BlockSize: 4096, Length: 8192, Disjoint: true},
+	} {
+		sizes, _ := newBlockSizes(p)
+		if _, err := workerRegion(p, sizes, size, 0, 4); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+
+	g, err := newOffsetGen(Params{BlockSize: 4096, Rand: true}, region{base: 65536, blocks: 2, unit: 4096}, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if off := g.Next(4096); off != 65536 && off != 69632 {
+			t.Fatalf("offset %d outside region", off)
+		}
+	}
+}
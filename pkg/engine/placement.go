@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Placement records where the workers of a run were placed (Params.CPUs).
+type Placement struct {
+	CPUs string `json:"cpus"`           // CPUs the workers were pinned to, one each, round-robin
+	Node int    `json:"node"`           // NUMA node the buffers were allocated on; -1 if not bound
+	From string `json:"from,omitempty"` // What selected the node: "device" for "local", else empty
+}
+
+// placer pins workers and allocates their buffers according to Params.CPUs.
+// A nil placer leaves both to the OS.
+type placer struct {
+	cpus []int
+	node int
+}
+
+func newPlacer(params Params) (*placer, error) {
+	spec := params.CPUs
+	if spec == "" {
+		return nil, nil
+	}
+	pl := &placer{node: -1}
+	switch {
+	case spec == "local":
+		node, err := deviceNode(params.Path)
+		if err != nil {
+			return nil, fmt.Errorf("can't find the NUMA node of %s: %w", params.Path, err)
+		}
+		pl.node = node
+	case strings.HasPrefix(spec, "node:"):
+		node, err := strconv.Atoi(strings.TrimPrefix(spec, "node:"))
+		if err != nil || node < 0 {
+			return nil, fmt.Errorf("invalid NUMA node in %q", spec)
+		}
+		pl.node = node
+	default:
+		cpus, err := parseCPUList(spec)
+		if err != nil {
+			return nil, err
+		}
+		pl.cpus = cpus
+	}
+	if pl.node >= 0 {
+		b, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", pl.node))
+		if err != nil {
+			return nil, fmt.Errorf("NUMA node %d: %w", pl.node, err)
+		}
+		if pl.cpus, err = parseCPUList(strings.TrimSpace(string(b))); err != nil {
+			return nil, fmt.Errorf("NUMA node %d: %w", pl.node, err)
+		}
+	}
+	return pl, nil
+}
+
+// pin locks the calling goroutine to its OS thread and pins the thread to
+// worker id's CPU. The thread is never unlocked, so the runtime discards it
+// when the worker exits instead of reusing it with the affinity set.
+func (pl *placer) pin(id int) error {
+	if pl == nil {
+		return nil
+	}
+	runtime.LockOSThread()
+	cpu := pl.cpus[id%len(pl.cpus)]
+	if err := setAffinity(cpu); err != nil {
+		return fmt.Errorf("can't pin worker %d to CPU %d: %w", id, cpu, err)
+	}
+	return nil
+}
+
+// mmap allocates an aligned, zeroed buffer, on the placer's NUMA node if it
+// has one.
+func (pl *placer) mmap(size int) ([]byte, error) {
+	buf, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate aligned memory: %v", err)
+	}
+	if pl != nil && pl.node >= 0 {
+		if err := bindNode(buf, pl.node); err != nil {
+			unix.Munmap(buf)
+			return nil, fmt.Errorf("can't bind buffers to NUMA node %d: %w", pl.node, err)
+		}
+	}
+	return buf, nil
+}
+
+// placement describes the placer for Result.Placement.
+func (pl *placer) placement(params Params) *Placement {
+	if pl == nil {
+		return nil
+	}
+	p := &Placement{CPUs: formatCPUList(pl.cpus), Node: pl.node}
+	if params.CPUs == "local" {
+		p.From = "device"
+	}
+	return p
+}
+
+// parseCPUList parses a kernel-style CPU list such as "0-3,8,10-11".
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(lo)
+		b := a
+		if err == nil && isRange {
+			b, err = strconv.Atoi(hi)
+		}
+		if err != nil || a < 0 || b < a {
+			return nil, fmt.Errorf("invalid CPU list %q", s)
+		}
+		for cpu := a; cpu <= b; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// formatCPUList is the inverse of parseCPUList, collapsing runs into ranges.
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
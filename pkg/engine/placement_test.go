@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-3,8,10-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2, 3, 8, 10, 11}; !reflect.DeepEqual(cpus, want) {
+		t.Errorf("parsed %v, want %v", cpus, want)
+	}
+	if s := formatCPUList(cpus); s != "0-3,8,10-11" {
+		t.Errorf("formatted %q", s)
+	}
+	for _, bad := range []string{"", "a", "3-1", "1,,2", "-1"} {
+		if _, err := parseCPUList(bad); err == nil {
+			t.Errorf("parseCPUList(%q) succeeded", bad)
+		}
+	}
+	if _, err := newPlacer(Params{CPUs: "node:x"}); err == nil {
+		t.Errorf("bad node accepted")
+	}
+}
+
+func TestEngineRunPinned(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU placement needs Linux")
+	}
+	tmpFile, err := os.CreateTemp("", "jolt-test-pinned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, tc := range []struct {
+		cpus string
+		want Placement
+	}{
+		{"0", Placement{CPUs: "0", Node: -1}},
+		{"node:0", Placement{Node: 0}},
+		{"local", Placement{Node: 0, From: "device"}},
+	} {
+		params := Params{
+			EngineType: "sync",
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    50,
+			Rand:       true,
+			Workers:    2,
+			MinRuntime: 100 * time.Millisecond,
+			MaxRuntime: 100 * time.Millisecond,
+			CPUs:       tc.cpus,
+		}
+		res, err := mustNew(t, "sync").Run(context.Background(), params)
+		if err != nil {
+			// "local" needs the file system's device in sysfs, which
+			// containers and multi-node hosts may not provide.
+			if tc.cpus == "local" {
+				t.Logf("local: %v", err)
+				continue
+			}
+			t.Fatalf("%s: %v", tc.cpus, err)
+		}
+		if res.TotalIOs == 0 {
+			t.Errorf("%s: no I/O", tc.cpus)
+		}
+		p := res.Placement
+		if p == nil {
+			t.Fatalf("%s: no placement in the result", tc.cpus)
+		}
+		if tc.want.CPUs == "" {
+			tc.want.CPUs = p.CPUs // Depends on the host
+		}
+		if *p != tc.want {
+			t.Errorf("%s: placement %+v, want %+v", tc.cpus, *p, tc.want)
+		}
+	}
+}
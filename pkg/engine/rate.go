@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"time"
+)
+
+// pacer schedules I/O arrivals for open-loop (rate limited) workloads.
+// Engines measure latency from the intended arrival time handed out here
+// rather than from the moment the I/O was actually issued, so a stalled
+// device shows up as latency instead of silently lowering the offered load
+// (coordinated omission).
+type pacer struct {
+	interval time.Duration // Mean time between arrivals
+	poisson  bool
+	next     time.Time
+	r        *rand.Rand
+}
+
+// checkArrival validates Params.TargetIOPS and Arrival.
+func checkArrival(params Params) error {
+	// A worker's interval is at least that of the whole target rate; it
+	// must not round down to zero, or the pacer would never advance.
+	if math.IsNaN(params.TargetIOPS) || params.TargetIOPS > 0 && time.Duration(float64(time.Second)/params.TargetIOPS) <= 0 {
+		return fmt.Errorf("invalid target rate %v IOPS", params.TargetIOPS)
+	}
+	switch params.Arrival {
+	case "", "fixed", "poisson":
+		return nil
+	default:
+		return fmt.Errorf("unknown arrival process %q (want fixed or poisson)", params.Arrival)
+	}
+}
+
+// newPacer returns the pacer for worker id of numWorkers, or nil if params
+// describe a closed-loop workload. Workers split Params.TargetIOPS evenly and
+// their first arrivals are staggered so they don't fire in lockstep. start
+// should be taken once the worker is set up, or setup time would show up as
+// a backlog of late I/Os.
+func newPacer(params Params, id, numWorkers int, start time.Time, r *rand.Rand) *pacer {
+	if params.TargetIOPS <= 0 {
+		return nil
+	}
+	rate := params.TargetIOPS / float64(numWorkers)
+	interval := time.Duration(float64(time.Second) / rate)
+	p := &pacer{
+		interval: interval,
+		poisson:  params.Arrival == "poisson",
+		r:        r,
+	}
+	p.next = start.Add(interval * time.Duration(id) / time.Duration(numWorkers))
+	return p
+}
+
+// Peek returns the intended start time of the next I/O.
+func (p *pacer) Peek() time.Time {
+	return p.next
+}
+
+// Next returns the intended start time of the next I/O and schedules the one
+// after it.
+func (p *pacer) Next() time.Time {
+	t := p.next
+	if p.poisson {
+		p.next = p.next.Add(time.Duration(p.r.ExpFloat64() * float64(p.interval)))
+	} else {
+		p.next = p.next.Add(p.interval)
+	}
+	return t
+}
+
+// Due consumes and counts the remaining arrivals scheduled at or before t.
+// Workers call it when stopping to find how many I/Os were offered in total.
+func (p *pacer) Due(t time.Time) int64 {
+	var n int64
+	for !p.next.After(t) {
+		p.Next()
+		n++
+	}
+	return n
+}
+
+// spinThreshold is how long before a deadline sleepUntil stops sleeping and
+// starts spinning with Params.SpinWait. Timer wakeups can be a millisecond
+// late on VMs, and oversleeping would be charged to the I/O as latency.
+const spinThreshold = time.Millisecond
+
+// sleepUntil blocks until t, spinning for the last stretch if spin is set.
+// It returns false if done was closed first.
+func sleepUntil(t time.Time, spin bool, done chan struct{}) bool {
+	d := time.Until(t)
+	if spin {
+		d -= spinThreshold
+	}
+	if d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-done:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+	for time.Now().Before(t) {
+		runtime.Gosched()
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultEngine is used when no engine type is given.
+const DefaultEngine = "sync"
+
+// Capabilities describes what an engine can do.
+type Capabilities struct {
+	Async     bool // Keeps several I/Os in flight per worker
+	Trace     bool // Replays a recorded trace (Params.TraceFile)
+	Direct    bool // Honors Params.Direct
+	Simulated bool // Models a device instead of doing I/O; Params.Path is unused
+}
+
+// Registration describes an engine known to New.
+type Registration struct {
+	Name        string
+	Description string
+	Caps        Capabilities
+	Fio         string // Equivalent fio ioengine; empty if there is none
+
+	New func() Engine
+
+	// Available probes whether the engine works on this system, returning
+	// why not if it doesn't. Nil means it always does.
+	Available func() error
+}
+
+var registry = map[string]Registration{}
+
+// Register makes an engine available to New under r.Name. It panics if the
+// name is taken, and is meant to be called from init functions.
+func Register(r Registration) {
+	if _, ok := registry[r.Name]; ok {
+		panic(fmt.Sprintf("engine %q registered twice", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// Lookup returns the registration of the named engine.
+func Lookup(name string) (Registration, bool) {
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Engines returns all registered engines, sorted by name.
+func Engines() []Registration {
+	var rs []Registration
+	for _, r := range registry {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Name < rs[j].Name })
+	return rs
+}
+
+// Names returns the names of all registered engines, sorted.
+func Names() []string {
+	var names []string
+	for _, r := range Engines() {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// New returns an Engine of the requested type, or DefaultEngine if it is
+// empty. It doesn't probe availability; an engine the system can't run fails
+// when it is run.
+func New(engineType string) (Engine, error) {
+	if engineType == "" {
+		engineType = DefaultEngine
+	}
+	r, ok := registry[engineType]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q (available: %s)", engineType, strings.Join(Names(), ", "))
+	}
+	return r.New(), nil
+}
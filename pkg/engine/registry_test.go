@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustNew returns the named engine, failing the test if there is none.
+func mustNew(t testing.TB, engineType string) Engine {
+	t.Helper()
+	eng, err := New(engineType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eng
+}
+
+func TestRegistry(t *testing.T) {
+	want := []string{"libaio", "replay", "sim", "sync", "uring"}
+	if got := strings.Join(Names(), ","); got != strings.Join(want, ",") {
+		t.Errorf("Names() = %s, want %s", got, strings.Join(want, ","))
+	}
+	for _, name := range want {
+		r, ok := Lookup(name)
+		if !ok || r.New == nil {
+			t.Fatalf("%s: not registered", name)
+		}
+		eng, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q): %v", name, err)
+		}
+		if eng == nil {
+			t.Errorf("New(%q) returned nil", name)
+		}
+	}
+	if r, _ := Lookup("replay"); !r.Caps.Trace || r.Caps.Async {
+		t.Errorf("replay capabilities = %+v", r.Caps)
+	}
+	if r, _ := Lookup("uring"); !r.Caps.Async || r.Fio != "io_uring" {
+		t.Errorf("uring registration = %+v", r)
+	}
+
+	// No silent fallback for typos; an empty name is the default.
+	if _, err := New("iouring"); err == nil || !strings.Contains(err.Error(), "uring") {
+		t.Errorf("New(\"iouring\") error = %v, want unknown engine listing the available ones", err)
+	}
+	if eng, err := New(""); err != nil {
+		t.Errorf("New(\"\"): %v", err)
+	} else if _, ok := eng.(*SyncEngine); !ok {
+		t.Errorf("New(\"\") = %T, want *SyncEngine", eng)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering sync twice didn't panic")
+		}
+	}()
+	Register(Registration{Name: "sync", New: func() Engine { return NewSync() }})
+}
@@ -0,0 +1,349 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ReplayEngine replays a recorded I/O trace (Params.TraceFile) against
+// Params.Path using synchronous workers, like SyncEngine. Trace offsets
+// are mapped into the configured region modulo its size.
+//
+// Params.ReplaySpeed selects the timing: 0 issues I/Os as fast as the
+// workers allow, 1 keeps the original timestamps and 2 replays twice as
+// fast. In timed modes latency is measured from the scheduled time, as in
+// open-loop mode. The trace is repeated until MinRuntime has passed.
+type ReplayEngine struct {
+}
+
+func init() {
+	Register(Registration{
+		Name:        "replay",
+		Description: "Replays a CSV or blkparse trace with synchronous workers",
+		Caps:        Capabilities{Trace: true, Direct: true},
+		New:         func() Engine { return NewReplay() },
+	})
+}
+
+func NewReplay() *ReplayEngine {
+	return &ReplayEngine{}
+}
+
+func (e *ReplayEngine) NumNodes() int { return 1 }
+
+// replayItem is a trace I/O handed from the dispatcher to a worker.
+type replayItem struct {
+	offset   int64
+	size     int
+	isRead   bool
+	intended time.Time // Zero when replaying as fast as possible
+}
+
+func (e *ReplayEngine) Run(ctx context.Context, params Params) (*Result, error) {
+	if params.TraceFile == "" {
+		return nil, fmt.Errorf("replay engine requires a trace file")
+	}
+	if params.ReplaySpeed < 0 {
+		return nil, fmt.Errorf("invalid replay speed: %g", params.ReplaySpeed)
+	}
+	if params.Verify != "" {
+		return nil, fmt.Errorf("verify is not supported by the replay engine")
+	}
+	if err := checkDiscard(params, "replay", false); err != nil {
+		return nil, err
+	}
+	if err := checkFlush(params, "replay", false); err != nil {
+		return nil, err
+	}
+	if err := checkData(params, "replay", true); err != nil {
+		return nil, err
+	}
+	if err := checkThink(params, "replay", false); err != nil {
+		return nil, err
+	}
+	if len(params.Groups) > 0 {
+		return nil, fmt.Errorf("groups are not supported by the replay engine")
+	}
+	ctl, err := newController(params)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := newPlacer(params)
+	if err != nil {
+		return nil, err
+	}
+	ios, err := loadTrace(params.TraceFile)
+	if err != nil {
+		return nil, err
+	}
+	items, maxSize, err := mapTrace(params, ios)
+	if err != nil {
+		return nil, err
+	}
+	readOnly := true
+	for _, item := range items {
+		readOnly = readOnly && item.isRead
+	}
+
+	numWorkers := params.Workers
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+	qd := params.QueueDepth
+	if qd <= 0 {
+		qd = numWorkers
+	}
+	tokens := make(chan struct{}, qd)
+	for i := 0; i < qd; i++ {
+		tokens <- struct{}{}
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan workerResult, numWorkers)
+	done := make(chan struct{})
+	queue := make(chan replayItem, qd)
+	var offered int64
+
+	// Measurement starts once the ramp is over. Workers keep issuing I/O
+	// during the ramp but don't record it.
+	start := time.Now().Add(params.RampTime)
+	go e.dispatch(params, ios, items, start, queue, done, &offered)
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			results <- e.runWorker(id, params, maxSize, readOnly, start, queue, tokens, done, ctl, pl)
+		}(i)
+	}
+	// The workers only stop by themselves once they have drained the queue
+	// after the last pass of the trace.
+	traceDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(traceDone)
+	}()
+
+	monitorTicker := time.NewTicker(100 * time.Millisecond)
+	defer monitorTicker.Stop()
+
+	var reason string
+
+	for {
+		select {
+		case <-ctx.Done():
+			reason = "Cancelled"
+			goto Finished
+		case <-traceDone:
+			reason = "Trace Complete"
+			goto Finished
+		case <-monitorTicker.C:
+			now := time.Now()
+			if now.Before(start) {
+				continue // Still ramping
+			}
+			if reason = ctl.tick(now.Sub(start)); reason != "" {
+				goto Finished
+			}
+		}
+	}
+
+Finished:
+	close(done)
+	wg.Wait()
+	cpu := ctl.cpu()
+	dev := ctl.device()
+	close(results)
+
+	duration := time.Since(start)
+
+	syncEng := &SyncEngine{}
+	res, err := syncEng.aggregate(results, duration, ctl.relErr)
+	if err != nil {
+		return nil, err
+	}
+	res.TerminationReason = reason
+	res.Placement = pl.placement(params)
+	res.CPU = cpu
+	res.Device = dev
+	res.Series = ctl.finishSeries(duration)
+	if params.ReplaySpeed > 0 && duration > 0 {
+		res.OfferedIOPS = float64(atomic.LoadInt64(&offered)) / duration.Seconds()
+	}
+	if reason == "Cancelled" {
+		return res, ctx.Err()
+	}
+	return res, nil
+}
+
+// mapTrace moves the trace I/Os into the region of the target selected by
+// params. It returns them along with the largest I/O size.
+func mapTrace(params Params, ios []traceIO) ([]replayItem, int, error) {
+	f, err := os.Open(params.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Offsets keep the 512 byte sector alignment of block traces, unless
+	// O_DIRECT needs them aligned to a larger logical block.
+	align := 512
+	if params.Direct {
+		if align, err = logicalBlockSize(f); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	maxSize := 0
+	for _, tio := range ios {
+		maxSize = max(maxSize, tio.size)
+	}
+	sizes := blockSizes{min: align, max: maxSize, align: align}
+	rg, err := workerRegion(params, sizes, size, 0, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]replayItem, len(ios))
+	span := rg.blocks * rg.unit
+	for i, tio := range ios {
+		off := rg.base + (tio.offset%span)/rg.unit*rg.unit
+		if off+int64(tio.size) > rg.end() {
+			off = rg.end() - int64(tio.size)
+		}
+		items[i] = replayItem{offset: off, size: tio.size, isRead: tio.isRead}
+	}
+	return items, maxSize, nil
+}
+
+// dispatch feeds the trace to the workers, repeating it until MinRuntime has
+// passed since measureFrom, and then closes queue.
+func (e *ReplayEngine) dispatch(params Params, ios []traceIO, items []replayItem, measureFrom time.Time, queue chan<- replayItem, done chan struct{}, offered *int64) {
+	for {
+		passStart := time.Now()
+		for i, item := range items {
+			if params.ReplaySpeed > 0 {
+				item.intended = passStart.Add(time.Duration(float64(ios[i].at) / params.ReplaySpeed))
+				if !sleepUntil(item.intended, params.SpinWait, done) {
+					return
+				}
+			}
+			select {
+			case queue <- item:
+				if !item.intended.Before(measureFrom) {
+					atomic.AddInt64(offered, 1)
+				}
+			case <-done:
+				return
+			}
+		}
+		if time.Since(measureFrom) >= params.MinRuntime {
+			close(queue)
+			return
+		}
+	}
+}
+
+func (e *ReplayEngine) runWorker(id int, params Params, maxSize int, readOnly bool, measureFrom time.Time, queue <-chan replayItem, tokens chan struct{}, done chan struct{}, ctl *controller, pl *placer) workerResult {
+	if err := pl.pin(id); err != nil {
+		return workerResult{err: err}
+	}
+	flags := os.O_RDWR
+	if readOnly {
+		flags = os.O_RDONLY
+	}
+	if params.Direct {
+		flags |= O_DIRECT
+	}
+	syncFlag, _ := syncOpenFlag(params.SyncMode)
+	flags |= syncFlag
+	f, err := os.OpenFile(params.Path, flags, 0666)
+	if err != nil {
+		return workerResult{err: err}
+	}
+	defer f.Close()
+
+	alignedBlock, err := pl.mmap(maxSize)
+	if err != nil {
+		return workerResult{err: err}
+	}
+	defer unix.Munmap(alignedBlock)
+
+	wr := newWorkerResult()
+	gen := newDataGen(params, 1, time.Now().UnixNano()+int64(id))
+
+	var traceSpans []Span
+	const traceBatchSize = 1000
+
+	finish := func() workerResult {
+		if params.TraceChannel != nil && len(traceSpans) > 0 {
+			params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: math.MaxInt64}
+		}
+		return wr
+	}
+
+	for {
+		var item replayItem
+		var ok bool
+		select {
+		case <-done:
+			return finish()
+		case item, ok = <-queue:
+			if !ok {
+				return finish()
+			}
+		}
+
+		select {
+		case <-done:
+			return finish()
+		case <-tokens:
+		}
+
+		buf := alignedBlock[:item.size]
+		gen.prepare(buf, 0, item.isRead)
+		ioStart := time.Now()
+		var n int
+		if item.isRead {
+			n, err = f.ReadAt(buf, item.offset)
+		} else {
+			n, err = f.WriteAt(buf, item.offset)
+		}
+		ioEnd := time.Now()
+
+		tokens <- struct{}{}
+
+		ramping := ioEnd.Before(measureFrom)
+		if params.TraceChannel != nil && !ramping {
+			traceSpans = append(traceSpans, Span{Start: ioStart.UnixNano(), End: ioEnd.UnixNano()})
+			if len(traceSpans) >= traceBatchSize {
+				params.TraceChannel <- TraceMsg{WorkerID: id, Spans: traceSpans, MinStart: ioEnd.UnixNano()}
+				traceSpans = nil
+			}
+		}
+
+		if err != nil && err != io.EOF {
+			return workerResult{err: err}
+		}
+		if n > 0 && !ramping {
+			latStart := ioStart
+			if !item.intended.IsZero() {
+				latStart = item.intended
+			}
+			us := ioEnd.Sub(latStart).Microseconds()
+			wr.record(item.isRead, us, n)
+			ctl.record(us, int64(n))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrace(t *testing.T) {
+	input := `# comment
+time,offset,size,op
+0.5,8192,4096,W
+0.25,0,4096,R
+0.75,4096,8192,T
+  8,0    3        1     1.000000000   697  Q  WS 16 + 8 [kjournald]
+  8,0    3        2     1.000100000   697  D  WS 16 + 8 [kjournald]
+  8,0    3        3     1.500000000   697  Q   D 32 + 8 [fstrim]
+CPU3 (8,0):
+`
+	ios, err := parseTrace(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []traceIO{
+		{at: 0, offset: 0, size: 4096, isRead: true},
+		{at: 250 * time.Millisecond, offset: 8192, size: 4096},
+		{at: 750 * time.Millisecond, offset: 8192, size: 4096},
+	}
+	if len(ios) != len(want) {
+		t.Fatalf("got %d I/Os, want %d: %+v", len(ios), len(want), ios)
+	}
+	for i := range want {
+		if ios[i] != want[i] {
+			t.Errorf("I/O %d: got %+v, want %+v", i, ios[i], want[i])
+		}
+	}
+
+	if _, err := parseTrace(strings.NewReader("0.1,abc,4096,R\n")); err == nil {
+		t.Error("expected error for bad offset")
+	}
+}
+
+func TestReplayEngine(t *testing.T) {
+	target, err := os.CreateTemp("", "jolt-test-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(target.Name())
+	if err := target.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	target.Close()
+
+	// 200 I/Os over 100ms; offsets past the end of the target wrap around.
+	trace, err := os.CreateTemp("", "jolt-test-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(trace.Name())
+	for i := 0; i < 200; i++ {
+		op := "R"
+		if i%4 == 0 {
+			op = "W"
+		}
+		fmt.Fprintf(trace, "%.4f,%d,4096,%s\n", float64(i)*0.0005, int64(i)*1000*4096, op)
+	}
+	trace.Close()
+
+	params := Params{
+		EngineType: "replay",
+		Path:       target.Name(),
+		TraceFile:  trace.Name(),
+		Workers:    2,
+		QueueDepth: 2,
+		MinRuntime: 200 * time.Millisecond,
+		MaxRuntime: 2 * time.Second,
+	}
+
+	params.ReplaySpeed = 1
+	res, err := mustNew(t, "replay").Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if res.TerminationReason != "Trace Complete" {
+		t.Errorf("expected the trace to finish, got %q", res.TerminationReason)
+	}
+	// Original timing is 2000 IOPS.
+	if res.IOPS < 1000 || res.IOPS > 3000 {
+		t.Errorf("original timing: IOPS %.0f, want ~2000", res.IOPS)
+	}
+	if res.Write.TotalIOs == 0 || res.Read.TotalIOs < 2*res.Write.TotalIOs {
+		t.Errorf("unexpected mix: %d reads, %d writes", res.Read.TotalIOs, res.Write.TotalIOs)
+	}
+
+	params.ReplaySpeed = 0
+	afap, err := mustNew(t, "replay").Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if afap.IOPS <= res.IOPS {
+		t.Errorf("as fast as possible (%.0f IOPS) not faster than original timing (%.0f IOPS)", afap.IOPS, res.IOPS)
+	}
+
+	// A single pass issues every I/O of the trace, including those still
+	// queued when the dispatcher reaches its end.
+	params.MinRuntime = 0
+	params.Workers, params.QueueDepth = 1, 64
+	once, err := mustNew(t, "replay").Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if once.TerminationReason != "Trace Complete" || once.TotalIOs != 200 {
+		t.Errorf("single pass: %d I/Os (%s), want 200", once.TotalIOs, once.TerminationReason)
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SeriesPoint is one interval of a run's time series (Params.SeriesInterval).
+// Latency percentiles are those of the I/Os completed in the interval, with
+// the ~6% resolution of the live histogram the convergence check uses.
+type SeriesPoint struct {
+	Time       time.Duration // End of the interval, from the start of measurement
+	IOPS       float64
+	Throughput float64 // Bytes/s
+	P50Latency time.Duration
+	P99Latency time.Duration
+}
+
+// MergeSeries lines up the time series of runs that ran at once by
+// interval. Rates add up; the latencies are those of the slowest run, as
+// percentiles can't be combined without the interval histograms.
+func MergeSeries(rs ...*Result) []SeriesPoint {
+	var merged []SeriesPoint
+	for _, r := range rs {
+		if r == nil {
+			continue
+		}
+		for i, p := range r.Series {
+			if i == len(merged) {
+				merged = append(merged, SeriesPoint{Time: p.Time})
+			}
+			m := &merged[i]
+			m.IOPS += p.IOPS
+			m.Throughput += p.Throughput
+			m.P50Latency = max(m.P50Latency, p.P50Latency)
+			m.P99Latency = max(m.P99Latency, p.P99Latency)
+		}
+	}
+	return merged
+}
+
+// WriteSeriesCSV writes series as CSV with a header line, in the units of
+// fio's logs: milliseconds and microseconds.
+func WriteSeriesCSV(w io.Writer, series []SeriesPoint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time_ms", "iops", "throughput_bytes", "p50_us", "p99_us"})
+	for _, p := range series {
+		cw.Write([]string{
+			fmt.Sprint(p.Time.Milliseconds()),
+			fmt.Sprintf("%.1f", p.IOPS),
+			fmt.Sprintf("%.0f", p.Throughput),
+			fmt.Sprint(p.P50Latency.Microseconds()),
+			fmt.Sprint(p.P99Latency.Microseconds()),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+	c, err := newController(Params{SeriesInterval: 500 * time.Millisecond, MaxRuntime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1000 I/Os of 4KiB per 100ms tick, except for a stall in the third
+	// half second, and a last tick that ends 50ms in.
+	drive(c, 20, func(i int) int {
+		if i >= 10 && i < 15 {
+			return 0
+		}
+		return 1000
+	}, func(int) int64 { return 200 })
+	for i := 0; i < 500; i++ {
+		c.record(200, 4096)
+	}
+	series := c.finishSeries(2050 * time.Millisecond)
+
+	if len(series) != 5 {
+		t.Fatalf("%d points, want 5: %+v", len(series), series)
+	}
+	for i, p := range series {
+		want := 10000.0
+		if i == 2 {
+			want = 0
+		}
+		if math.Abs(p.IOPS-want) > 1 || math.Abs(p.Throughput-want*4096) > 4096 {
+			t.Errorf("point %d: %.0f IOPS, %.0f B/s, want %.0f IOPS", i, p.IOPS, p.Throughput, want)
+		}
+		if i != 2 && math.Abs(float64(p.P99Latency-200*time.Microsecond)) > 0.0625*float64(200*time.Microsecond) {
+			t.Errorf("point %d: P99 %v, want about 200µs", i, p.P99Latency)
+		}
+	}
+	if series[2].P99Latency != 0 {
+		t.Errorf("stalled interval has P99 %v", series[2].P99Latency)
+	}
+	if series[4].Time != 2050*time.Millisecond {
+		t.Errorf("last point ends at %v", series[4].Time)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSeriesCSV(&buf, series[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "time_ms,iops,throughput_bytes,p50_us,p99_us\n500,10000.0,40960000,"; !bytes.HasPrefix(buf.Bytes(), []byte(want)) {
+		t.Errorf("CSV %q, want it to start with %q", buf.String(), want)
+	}
+}
+
+func TestSimSeries(t *testing.T) {
+	params := simParams(4, 32)
+	params.SeriesInterval = 200 * time.Millisecond
+	res, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Series) != 5 {
+		t.Fatalf("%d points in a 1s run at 200ms", len(res.Series))
+	}
+	sum := 0.0
+	for i, p := range res.Series {
+		if p.Time != time.Duration(i+1)*200*time.Millisecond {
+			t.Errorf("point %d at %v", i, p.Time)
+		}
+		if p.P50Latency <= 0 || p.P99Latency < p.P50Latency {
+			t.Errorf("point %d: P50 %v, P99 %v", i, p.P50Latency, p.P99Latency)
+		}
+		sum += p.IOPS
+	}
+	if mean := sum / 5; math.Abs(mean-res.IOPS) > 0.01*res.IOPS {
+		t.Errorf("series averages %.0f IOPS, result has %.0f", mean, res.IOPS)
+	}
+
+	params.SeriesInterval = 0
+	if res, err = NewSim().Run(context.Background(), params); err != nil || res.Series != nil {
+		t.Errorf("series without an interval: %v, %v", res.Series, err)
+	}
+}
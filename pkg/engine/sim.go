@@ -0,0 +1,393 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SimEngine models a storage device instead of doing I/O, so the optimizer
+// and analyzers can be exercised without a disk. Time is simulated: a run
+// takes a fraction of its reported Duration, and the same Params (including
+// the device's Seed) always produce the same Result.
+//
+// The device has Channels identical service units fed from one FIFO queue.
+// An op's service time is its base latency, scaled by a random factor drawn
+// from ServiceDist, plus its transfer time at ChannelBandwidth. Writes are
+// serviced at WriteLatency while they fit in the write cache, which drains
+// at DrainRate; once it is full they take CliffLatency instead. On the host
+// side each worker spends HostOverhead per I/O, which caps what one worker
+// can drive no matter how deep its queue.
+type SimEngine struct {
+}
+
+func init() {
+	Register(Registration{
+		Name:        "sim",
+		Description: "Simulated device on a virtual clock; no I/O",
+		Caps:        Capabilities{Async: true, Simulated: true},
+		New:         func() Engine { return NewSim() },
+	})
+}
+
+func NewSim() *SimEngine {
+	return &SimEngine{}
+}
+
+func (e *SimEngine) NumNodes() int { return 1 }
+
+// SimDevice describes the device modelled by the "sim" engine. Zero fields
+// take their value from DefaultSimDevice.
+type SimDevice struct {
+	Channels         int           `yaml:"channels,omitempty"`          // Internal parallelism (dies, queues)
+	ReadLatency      time.Duration `yaml:"read_latency,omitempty"`      // Mean base service time of a read
+	WriteLatency     time.Duration `yaml:"write_latency,omitempty"`     // Mean base service time of a cached write
+	ChannelBandwidth float64       `yaml:"channel_bandwidth,omitempty"` // Bytes/s one channel transfers
+	ServiceDist      string        `yaml:"service_dist,omitempty"`      // "fixed", "exp" or "lognormal:<sigma>"
+	WriteCache       int64         `yaml:"write_cache,omitempty"`       // Bytes of write cache; 0 disables the cliff
+	DrainRate        float64       `yaml:"drain_rate,omitempty"`        // Bytes/s the write cache destages at
+	CliffLatency     time.Duration `yaml:"cliff_latency,omitempty"`     // Mean base service time of a write once the cache is full
+	HostOverhead     time.Duration `yaml:"host_overhead,omitempty"`     // CPU time a worker spends per I/O
+	Seed             int64         `yaml:"seed,omitempty"`
+}
+
+// DefaultSimDevice is roughly a mid-range NVMe drive: about 300k 4KiB random
+// read IOPS and 6 GB/s of large reads.
+var DefaultSimDevice = SimDevice{
+	Channels:         32,
+	ReadLatency:      80 * time.Microsecond,
+	WriteLatency:     20 * time.Microsecond,
+	ChannelBandwidth: 200e6,
+	ServiceDist:      "lognormal:0.5",
+	DrainRate:        500e6,
+	CliffLatency:     400 * time.Microsecond,
+	HostOverhead:     2 * time.Microsecond,
+	Seed:             1,
+}
+
+func (d SimDevice) withDefaults() SimDevice {
+	def := DefaultSimDevice
+	if d.Channels <= 0 {
+		d.Channels = def.Channels
+	}
+	if d.ReadLatency <= 0 {
+		d.ReadLatency = def.ReadLatency
+	}
+	if d.WriteLatency <= 0 {
+		d.WriteLatency = def.WriteLatency
+	}
+	if d.ChannelBandwidth <= 0 {
+		d.ChannelBandwidth = def.ChannelBandwidth
+	}
+	if d.ServiceDist == "" {
+		d.ServiceDist = def.ServiceDist
+	}
+	if d.DrainRate <= 0 {
+		d.DrainRate = def.DrainRate
+	}
+	if d.CliffLatency <= 0 {
+		d.CliffLatency = def.CliffLatency
+	}
+	if d.HostOverhead < 0 {
+		d.HostOverhead = 0
+	}
+	if d.Seed == 0 {
+		d.Seed = def.Seed
+	}
+	return d
+}
+
+// parseServiceDist returns a sampler of service time factors with mean 1.
+func parseServiceDist(s string) (func(r *rand.Rand) float64, error) {
+	name, arg, _ := strings.Cut(s, ":")
+	switch name {
+	case "fixed":
+		return func(*rand.Rand) float64 { return 1 }, nil
+	case "exp":
+		return (*rand.Rand).ExpFloat64, nil
+	case "lognormal":
+		sigma, err := strconv.ParseFloat(arg, 64)
+		if err != nil || sigma < 0 {
+			return nil, fmt.Errorf("invalid lognormal sigma %q", arg)
+		}
+		return func(r *rand.Rand) float64 {
+			return math.Exp(sigma*r.NormFloat64() - sigma*sigma/2)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown service time distribution %q", s)
+}
+
+// simIO is an I/O in flight on the simulated device. Times are virtual,
+// relative to the start of the run.
+type simIO struct {
+	start    time.Duration // Submitted by the worker
+	intended time.Duration // Scheduled arrival in open-loop mode
+	end      time.Duration
+	slot     int
+	isRead   bool
+	size     int
+}
+
+// simQueue orders in-flight I/Os by completion time.
+type simQueue []simIO
+
+func (q simQueue) Len() int            { return len(q) }
+func (q simQueue) Less(i, j int) bool  { return q[i].end < q[j].end }
+func (q simQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *simQueue) Push(x interface{}) { *q = append(*q, x.(simIO)) }
+func (q *simQueue) Pop() interface{} {
+	old := *q
+	io := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return io
+}
+
+func (e *SimEngine) Run(ctx context.Context, params Params) (*Result, error) {
+	if params.Verify != "" {
+		return nil, fmt.Errorf("verify is not supported by the sim engine")
+	}
+	if params.SyncMode != "" || params.FsyncEvery != 0 {
+		return nil, fmt.Errorf("sync writes and flushes are not modelled by the sim engine")
+	}
+	if err := checkDiscard(params, "sim", false); err != nil {
+		return nil, err
+	}
+	if err := checkData(params, "sim", false); err != nil {
+		return nil, err
+	}
+	if err := checkThink(params, "sim", true); err != nil {
+		return nil, err
+	}
+	if err := checkArrival(params); err != nil {
+		return nil, err
+	}
+	if params.CPUs != "" {
+		return nil, fmt.Errorf("CPU placement is not supported by the sim engine")
+	}
+	if len(params.Groups) > 0 {
+		// Each group would get a device of its own.
+		return nil, fmt.Errorf("groups are not supported by the sim engine")
+	}
+	sizes, err := newBlockSizes(params)
+	if err != nil {
+		return nil, err
+	}
+	dev := DefaultSimDevice
+	if params.Sim != nil {
+		dev = params.Sim.withDefaults()
+	}
+	factor, err := parseServiceDist(dev.ServiceDist)
+	if err != nil {
+		return nil, err
+	}
+	ctl, err := newController(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same slot accounting as the async engines: QueueDepth I/Os in flight,
+	// shared by at most that many workers.
+	numWorkers := params.Workers
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+	qd := params.QueueDepth
+	if qd <= 0 {
+		qd = numWorkers
+	}
+	numWorkers = min(numWorkers, qd)
+
+	r := rand.New(rand.NewSource(dev.Seed))
+	epoch := time.Now() // Only anchors the trace spans
+	measureFrom := params.RampTime
+	pace := newPacer(params, 0, 1, epoch, r)
+
+	wrs := make([]workerResult, numWorkers)
+	for i := range wrs {
+		wrs[i] = newWorkerResult()
+	}
+	busy := make([]time.Duration, numWorkers)       // When each worker is next free to submit
+	channels := make([]time.Duration, dev.Channels) // When each channel is next idle
+	var cache float64                               // Bytes in the write cache
+	var cacheAt time.Duration
+	var offered int64
+	q := make(simQueue, 0, qd)
+	ths := make([]*thinker, numWorkers)
+	held := make([][]int, numWorkers) // Slots waiting for their worker's burst to drain
+	inFlight := make([]int, numWorkers)
+	for w := range ths {
+		ths[w] = newThinker(params, r)
+	}
+
+	// issue submits the next I/O of slot, which became free at t.
+	issue := func(slot int, t time.Duration) {
+		w := slot % numWorkers
+		if th := ths[w]; th != nil {
+			if th.draining() {
+				held[w] = append(held[w], slot)
+				return
+			}
+			t = max(t, th.next.Sub(epoch))
+			th.issued(epoch.Add(t))
+		}
+		inFlight[w]++
+		var intended time.Duration
+		if pace != nil {
+			intended = pace.Next().Sub(epoch)
+			t = max(t, intended)
+			if intended >= measureFrom {
+				offered++
+			}
+		}
+		start := max(t, busy[w])
+		busy[w] = start + dev.HostOverhead
+
+		isRead := true
+		if params.ReadPct < 100 {
+			if params.ReadPct == 0 || r.Intn(100) >= params.ReadPct {
+				isRead = false
+			}
+		}
+		size := sizes.pick(isRead, r)
+
+		c := 0
+		for i := range channels {
+			if channels[i] < channels[c] {
+				c = i
+			}
+		}
+		svcStart := max(busy[w], channels[c])
+
+		base := dev.ReadLatency
+		if !isRead {
+			base = dev.WriteLatency
+			if dev.WriteCache > 0 {
+				if svcStart > cacheAt {
+					cache = max(0, cache-dev.DrainRate*(svcStart-cacheAt).Seconds())
+					cacheAt = svcStart
+				}
+				if cache+float64(size) <= float64(dev.WriteCache) {
+					cache += float64(size)
+				} else {
+					base = dev.CliffLatency
+				}
+			}
+		}
+		svc := time.Duration(float64(base)*factor(r) + float64(size)/dev.ChannelBandwidth*float64(time.Second))
+		channels[c] = svcStart + svc
+		heap.Push(&q, simIO{start: start, intended: intended, end: svcStart + svc, slot: slot, isRead: isRead, size: size})
+	}
+
+	traceSpans := make([][]Span, numWorkers)
+	const traceBatchSize = 1000
+	// flushTrace sends worker w's spans. Its I/Os still in flight, and any
+	// it submits after now, start no earlier than the returned MinStart.
+	flushTrace := func(w int, now time.Duration) {
+		minStart := now
+		for _, io := range q {
+			if io.slot%numWorkers == w {
+				minStart = min(minStart, io.start)
+			}
+		}
+		params.TraceChannel <- TraceMsg{WorkerID: w, Spans: traceSpans[w], MinStart: epoch.Add(minStart).UnixNano()}
+		traceSpans[w] = nil
+	}
+
+	for slot := 0; slot < qd; slot++ {
+		issue(slot, 0)
+	}
+
+	// The monitor loop of the other engines, on the simulated clock.
+	const tick = 100 * time.Millisecond
+	nextTick := measureFrom + tick
+	var reason string
+	var stop time.Duration
+
+	for {
+		io := heap.Pop(&q).(simIO)
+		for io.end > nextTick {
+			reason = ctl.tick(nextTick - measureFrom)
+			if ctx.Err() != nil {
+				reason = "Cancelled"
+			}
+			if reason != "" {
+				stop = nextTick
+				heap.Push(&q, io) // Still in flight
+				goto Finished
+			}
+			nextTick += tick
+		}
+
+		if io.end >= measureFrom {
+			w := io.slot % numWorkers
+			latStart := io.start
+			if pace != nil {
+				latStart = io.intended
+			}
+			us := (io.end - latStart).Microseconds()
+			wrs[w].record(io.isRead, us, io.size)
+			ctl.record(us, int64(io.size))
+			if params.TraceChannel != nil {
+				traceSpans[w] = append(traceSpans[w], Span{Start: epoch.Add(io.start).UnixNano(), End: epoch.Add(io.end).UnixNano()})
+				if len(traceSpans[w]) >= traceBatchSize {
+					flushTrace(w, io.end)
+				}
+			}
+		}
+		w := io.slot % numWorkers
+		inFlight[w]--
+		ths[w].completed(epoch.Add(io.end))
+		issue(io.slot, io.end)
+		// The worker's burst is over: idle, then start the next one.
+		if th := ths[w]; th.draining() && inFlight[w] == 0 {
+			th.ready(epoch.Add(io.end), 0)
+			slots := held[w]
+			held[w] = nil
+			for _, slot := range slots {
+				issue(slot, io.end)
+			}
+		}
+	}
+
+Finished:
+	if pace != nil {
+		// Arrivals handed to I/Os that hadn't started by the end weren't
+		// offered during the run; the ones still waiting for a slot were.
+		for _, io := range q {
+			if io.intended > stop {
+				offered--
+			}
+		}
+		offered += pace.Due(epoch.Add(stop))
+		wrs[0].offered = offered
+	}
+	if params.TraceChannel != nil {
+		for w := range traceSpans {
+			if len(traceSpans[w]) > 0 {
+				params.TraceChannel <- TraceMsg{WorkerID: w, Spans: traceSpans[w], MinStart: math.MaxInt64}
+			}
+		}
+	}
+
+	results := make(chan workerResult, numWorkers)
+	for _, wr := range wrs {
+		results <- wr
+	}
+	close(results)
+	syncEng := &SyncEngine{}
+	res, err := syncEng.aggregate(results, stop-measureFrom, ctl.relErr)
+	if err != nil {
+		return nil, err
+	}
+	res.TerminationReason = reason
+	res.Series = ctl.finishSeries(stop - measureFrom)
+	if reason == "Cancelled" {
+		return res, ctx.Err()
+	}
+	return res, nil
+}
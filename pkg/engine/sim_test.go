@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func simParams(workers, qd int) Params {
+	return Params{
+		EngineType: "sim",
+		BlockSize:  4096,
+		ReadPct:    100,
+		Rand:       true,
+		Workers:    workers,
+		QueueDepth: qd,
+		MinRuntime: time.Second,
+		MaxRuntime: time.Second,
+	}
+}
+
+func TestSimDeterministic(t *testing.T) {
+	params := simParams(4, 32)
+	params.ReadPct = 70
+	params.BSSplit = "4k/80:64k/20"
+	a, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.TotalIOs != b.TotalIOs || a.P99Latency != b.P99Latency || a.Write.Bytes != b.Write.Bytes {
+		t.Errorf("runs differ: %+v vs %+v", a, b)
+	}
+
+	params.Sim = &SimDevice{Seed: 2}
+	c, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TotalIOs == a.TotalIOs {
+		t.Errorf("different seeds gave identical runs")
+	}
+}
+
+func TestSimScaling(t *testing.T) {
+	run := func(workers, qd int) *Result {
+		start := time.Now()
+		res, err := NewSim().Run(context.Background(), simParams(workers, qd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wall := time.Since(start); wall >= res.Duration {
+			t.Errorf("qd %d: simulated %v took %v", qd, res.Duration, wall)
+		}
+		t.Logf("workers=%d qd=%d: IOPS=%.0f P99=%v", workers, qd, res.IOPS, res.P99Latency)
+		return res
+	}
+
+	qd1 := run(1, 1)
+	qd16 := run(4, 16)
+	qd64 := run(4, 64)
+	qd256 := run(4, 256)
+	oneWorker := run(1, 256)
+
+	// Latency bound at low depth, channel bound at high depth.
+	if qd1.IOPS < 8000 || qd1.IOPS > 12000 {
+		t.Errorf("qd 1: IOPS = %.0f, want ~10k", qd1.IOPS)
+	}
+	if qd16.IOPS < 12*qd1.IOPS {
+		t.Errorf("qd 16 doesn't scale: %.0f vs %.0f", qd16.IOPS, qd1.IOPS)
+	}
+	if qd256.IOPS > 1.2*qd64.IOPS || qd256.P99Latency < 2*qd64.P99Latency {
+		t.Errorf("no saturation: qd 64 %.0f IOPS %v, qd 256 %.0f IOPS %v", qd64.IOPS, qd64.P99Latency, qd256.IOPS, qd256.P99Latency)
+	}
+	// One worker is capped by its per-I/O overhead.
+	if oneWorker.IOPS > 1e6/2*1.05 {
+		t.Errorf("one worker: IOPS = %.0f, above its host overhead limit", oneWorker.IOPS)
+	}
+}
+
+func TestSimWriteCliff(t *testing.T) {
+	params := simParams(4, 32)
+	params.ReadPct = 0
+	params.Sim = &SimDevice{WriteCache: 256 << 20}
+
+	params.MinRuntime, params.MaxRuntime = 200*time.Millisecond, 200*time.Millisecond
+	before, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.RampTime = 5 * time.Second
+	after, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("before cliff: %.0f IOPS, after: %.0f IOPS", before.IOPS, after.IOPS)
+	if after.IOPS > before.IOPS/2 {
+		t.Errorf("no write cliff: %.0f IOPS before, %.0f after", before.IOPS, after.IOPS)
+	}
+}
+
+func TestSimTrace(t *testing.T) {
+	params := simParams(4, 16)
+	ch := make(chan TraceMsg, 16)
+	params.TraceChannel = ch
+	spans := make(chan int)
+	go func() {
+		n := 0
+		// Spans may not start before a MinStart the worker promised earlier.
+		minStart := map[int]int64{}
+		for msg := range ch {
+			for _, s := range msg.Spans {
+				if s.End < s.Start || s.Start < minStart[msg.WorkerID] {
+					t.Errorf("worker %d: bad span %+v after MinStart %d", msg.WorkerID, s, minStart[msg.WorkerID])
+				}
+			}
+			minStart[msg.WorkerID] = msg.MinStart
+			n += len(msg.Spans)
+		}
+		spans <- n
+	}()
+	res, err := NewSim().Run(context.Background(), params)
+	close(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := <-spans; int64(n) != res.TotalIOs {
+		t.Errorf("got %d spans for %d I/Os", n, res.TotalIOs)
+	}
+}
@@ -2,6 +2,131 @@
 
 package engine
 
-import "syscall"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
 
 const O_DIRECT = syscall.O_DIRECT
+
+// Block device ioctls from linux/fs.h, missing from x/sys/unix.
+const (
+	blkDiscard = 0x1277 // _IO(0x12, 119)
+	blkZeroOut = 0x127f // _IO(0x12, 127)
+)
+
+// discardRange discards length bytes of f at off, or zeroes them if zero is
+// set. Block devices get BLKDISCARD/BLKZEROOUT, regular files a hole punch
+// or a zero range.
+func discardRange(f *os.File, isDev, zero bool, off, length int64) error {
+	if isDev {
+		req := uintptr(blkDiscard)
+		if zero {
+			req = blkZeroOut
+		}
+		rg := [2]uint64{uint64(off), uint64(length)}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(&rg))); errno != 0 {
+			return errno
+		}
+		return nil
+	}
+	mode := uint32(unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE)
+	if zero {
+		mode = unix.FALLOC_FL_ZERO_RANGE | unix.FALLOC_FL_KEEP_SIZE
+	}
+	return unix.Fallocate(int(f.Fd()), mode, off, length)
+}
+
+// logicalBlockSize returns the alignment O_DIRECT I/O to f needs: the logical
+// block size of a block device, or the block size of the file system holding
+// a regular file.
+func logicalBlockSize(f *os.File) (int, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &st); err != nil {
+		return 0, err
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		return unix.IoctlGetInt(int(f.Fd()), unix.BLKSSZGET)
+	}
+	return int(st.Blksize), nil
+}
+
+// setAffinity pins the calling thread to cpu.
+func setAffinity(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
+
+// bindNode makes the pages of buf come from NUMA node node. buf must not
+// have been touched yet.
+func bindNode(buf []byte, node int) error {
+	mask := make([]uint64, node/64+1)
+	mask[node/64] = 1 << (node % 64)
+	// The kernel ignores the last bit of maxnode.
+	maxNode := uintptr(len(mask)*64 + 1)
+	_, _, errno := syscall.Syscall6(unix.SYS_MBIND, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+		unix.MPOL_BIND, uintptr(unsafe.Pointer(&mask[0])), maxNode, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// blockDevice returns the device number of the block device at path, or of
+// the one holding the file system path is on.
+func blockDevice(path string) (major, minor uint32, err error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+	dev := st.Dev
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		dev = st.Rdev
+	}
+	return unix.Major(dev), unix.Minor(dev), nil
+}
+
+// deviceNode returns the NUMA node of the block device at path, or of the
+// one holding the file system path is on. It walks up the device's sysfs
+// ancestors to the first one with a numa_node, normally the PCI device. On
+// a host with a single node that is node 0 whatever sysfs says.
+func deviceNode(path string) (int, error) {
+	major, minor, err := blockDevice(path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat("/sys/devices/system/node/node1"); os.IsNotExist(err) {
+		return 0, nil
+	}
+	dir, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor))
+	if err != nil {
+		return 0, fmt.Errorf("no block device behind it")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		dir = filepath.Dir(dir)
+	}
+	d, err := filepath.EvalSymlinks(filepath.Join(dir, "device"))
+	if err != nil {
+		return 0, fmt.Errorf("%s has no backing device", filepath.Base(dir))
+	}
+	for ; strings.HasPrefix(d, "/sys/devices/"); d = filepath.Dir(d) {
+		b, err := os.ReadFile(filepath.Join(d, "numa_node"))
+		if err != nil {
+			continue
+		}
+		node, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || node < 0 {
+			break
+		}
+		return node, nil
+	}
+	return 0, fmt.Errorf("the kernel doesn't know which node %s is attached to", filepath.Base(dir))
+}
@@ -2,4 +2,33 @@
 
 package engine
 
+import (
+	"fmt"
+	"os"
+)
+
 const O_DIRECT = 0 // No-op on non-Linux
+
+func discardRange(f *os.File, isDev, zero bool, off, length int64) error {
+	return fmt.Errorf("discard and write-zeroes are only supported on Linux")
+}
+
+func logicalBlockSize(f *os.File) (int, error) {
+	return 512, nil
+}
+
+func setAffinity(cpu int) error {
+	return fmt.Errorf("CPU pinning is only supported on Linux")
+}
+
+func bindNode(buf []byte, node int) error {
+	return fmt.Errorf("NUMA placement is only supported on Linux")
+}
+
+func deviceNode(path string) (int, error) {
+	return 0, fmt.Errorf("NUMA placement is only supported on Linux")
+}
+
+func blockDevice(path string) (major, minor uint32, err error) {
+	return 0, 0, fmt.Errorf("block device statistics are only supported on Linux")
+}
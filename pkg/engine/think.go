@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// checkThink validates the think time and burst options (Params.ThinkTime,
+// ThinkDist, BurstIOs and BurstIdle). Engines that issue I/O on their own
+// schedule pass supported=false.
+func checkThink(params Params, engineType string, supported bool) error {
+	if params.ThinkTime < 0 || params.BurstIdle < 0 {
+		return fmt.Errorf("invalid think time %v or burst idle time %v", params.ThinkTime, params.BurstIdle)
+	}
+	if params.BurstIOs < 0 {
+		return fmt.Errorf("invalid burst size: %d", params.BurstIOs)
+	}
+	switch params.ThinkDist {
+	case "", "fixed", "exp":
+	default:
+		return fmt.Errorf("unknown think time distribution %q (want fixed or exp)", params.ThinkDist)
+	}
+	if params.BurstIdle > 0 && params.BurstIOs == 0 {
+		return fmt.Errorf("burst idle time needs a burst size")
+	}
+	if params.ThinkTime == 0 && params.BurstIOs == 0 {
+		return nil
+	}
+	if !supported {
+		return fmt.Errorf("think time and bursts are not supported by the %s engine", engineType)
+	}
+	if params.TargetIOPS > 0 {
+		return fmt.Errorf("think time and bursts are closed-loop only and can't be combined with a target IOPS")
+	}
+	return nil
+}
+
+// thinker pauses a closed-loop worker: ThinkTime after each of its I/Os is
+// issued and after each completes, and BurstIdle after every BurstIOs I/Os,
+// once all of them have completed, so the device sees the worker go quiet.
+// A nil thinker never pauses.
+type thinker struct {
+	think time.Duration
+	exp   bool
+	burst int
+	idle  time.Duration
+	spin  bool
+	r     *rand.Rand
+	n     int           // I/Os issued in the current burst
+	gap   time.Duration // Think time drawn for the last I/O issued
+	next  time.Time     // When the next I/O may be issued
+}
+
+func newThinker(params Params, r *rand.Rand) *thinker {
+	if params.ThinkTime == 0 && params.BurstIOs == 0 {
+		return nil
+	}
+	return &thinker{
+		think: params.ThinkTime,
+		exp:   params.ThinkDist == "exp",
+		burst: params.BurstIOs,
+		idle:  params.BurstIdle,
+		spin:  params.SpinWait,
+		r:     r,
+	}
+}
+
+// issued records that the worker issued an I/O at now, and draws the think
+// time before its next one.
+func (t *thinker) issued(now time.Time) {
+	if t == nil {
+		return
+	}
+	t.n++
+	t.gap = t.think
+	if t.exp {
+		t.gap = time.Duration(t.r.ExpFloat64() * float64(t.think))
+	}
+	t.next = laterOf(t.next, now.Add(t.gap))
+}
+
+// completed records that one of the worker's I/Os completed at now.
+func (t *thinker) completed(now time.Time) {
+	if t != nil {
+		t.next = laterOf(t.next, now.Add(t.gap))
+	}
+}
+
+// draining reports whether the current burst is over, so the worker must
+// let its I/Os in flight complete before idling.
+func (t *thinker) draining() bool {
+	return t != nil && t.burst > 0 && t.n >= t.burst
+}
+
+// ready reports whether the worker may issue an I/O at now, with inFlight of
+// its I/Os outstanding. Once a burst has drained, it starts the idle period.
+func (t *thinker) ready(now time.Time, inFlight int) bool {
+	if t == nil {
+		return true
+	}
+	if t.draining() {
+		if inFlight > 0 {
+			return false
+		}
+		t.n = 0
+		t.next = laterOf(t.next, now.Add(t.idle))
+	}
+	return !t.next.After(now)
+}
+
+// wait blocks a worker without I/Os in flight until it may issue the next.
+// It returns false if done was closed first.
+func (t *thinker) wait(done chan struct{}) bool {
+	if t == nil || t.ready(time.Now(), 0) {
+		return true
+	}
+	return sleepUntil(t.next, t.spin, done)
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
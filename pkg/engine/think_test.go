@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThinker(t *testing.T) {
+	if newThinker(Params{}, nil) != nil {
+		t.Errorf("thinker without think time or bursts")
+	}
+	now := time.Now()
+	th := newThinker(Params{ThinkTime: time.Millisecond, BurstIOs: 2, BurstIdle: time.Second}, rand.New(rand.NewSource(1)))
+	if !th.ready(now, 0) {
+		t.Fatalf("not ready to start")
+	}
+	th.issued(now.Add(-time.Millisecond))
+	th.completed(now)
+	if th.ready(now.Add(999*time.Microsecond), 0) || !th.ready(now.Add(time.Millisecond), 0) {
+		t.Errorf("think time not 1ms")
+	}
+	th.issued(now.Add(time.Millisecond))
+	th.completed(now.Add(2 * time.Millisecond))
+	if !th.draining() || th.ready(now.Add(time.Hour), 1) {
+		t.Errorf("burst of 2 not over")
+	}
+	// The idle period starts once the burst has drained.
+	end := now.Add(5 * time.Millisecond)
+	if th.ready(end, 0) || th.draining() {
+		t.Errorf("no idle after the burst")
+	}
+	if th.ready(end.Add(time.Second-time.Microsecond), 0) || !th.ready(end.Add(time.Second), 0) {
+		t.Errorf("idle time not 1s")
+	}
+
+	for _, p := range []Params{
+		{ThinkTime: -time.Millisecond},
+		{ThinkTime: time.Millisecond, ThinkDist: "normal"},
+		{BurstIdle: time.Second},
+		{BurstIOs: 8, TargetIOPS: 1000},
+	} {
+		if err := checkThink(p, "sync", true); err == nil {
+			t.Errorf("%+v accepted", p)
+		}
+	}
+	if err := checkThink(Params{ThinkTime: time.Millisecond}, "replay", false); err == nil {
+		t.Errorf("replay accepted think time")
+	}
+}
+
+func TestSimThinkTime(t *testing.T) {
+	params := simParams(1, 1)
+	params.ThinkTime = time.Millisecond
+	for _, dist := range []string{"fixed", "exp"} {
+		params.ThinkDist = dist
+		res, err := NewSim().Run(context.Background(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// One I/O per think time plus its ~80µs service time.
+		if res.IOPS < 850 || res.IOPS > 960 {
+			t.Errorf("%s: %.0f IOPS with 1ms think time", dist, res.IOPS)
+		}
+	}
+}
+
+func TestSimBursts(t *testing.T) {
+	params := simParams(4, 32)
+	params.ReadPct = 0
+	params.Sim = &SimDevice{WriteCache: 64 << 20}
+	params.RampTime = 5 * time.Second
+	params.MinRuntime, params.MaxRuntime = 2*time.Second, 2*time.Second
+	steady, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 32MiB bursts fit in the cache, which drains while the device idles.
+	params.BurstIOs, params.BurstIdle = 2048, 100*time.Millisecond
+	bursty, err := NewSim().Run(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("steady: %.0f IOPS, P99 %v; bursty: %.0f IOPS, P99 %v", steady.IOPS, steady.P99Latency, bursty.IOPS, bursty.P99Latency)
+	if bursty.P99Latency > steady.P99Latency/2 {
+		t.Errorf("bursts hit the write cliff: P99 %v, steady %v", bursty.P99Latency, steady.P99Latency)
+	}
+	// Every burst of 8192 I/Os is followed by 100ms of idle.
+	if max := 8192 / 0.1; bursty.IOPS > max {
+		t.Errorf("%.0f IOPS, more than the %.0f the idle periods allow", bursty.IOPS, max)
+	}
+}
+
+func TestEngineRunBursts(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-bursts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring", "libaio"} {
+		params := Params{
+			EngineType: engineType,
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    100,
+			Rand:       true,
+			Workers:    2,
+			QueueDepth: 8,
+			BurstIOs:   100,
+			BurstIdle:  50 * time.Millisecond,
+			MinRuntime: 500 * time.Millisecond,
+			MaxRuntime: 500 * time.Millisecond,
+		}
+		res, err := mustNew(t, engineType).Run(context.Background(), params)
+		if err != nil {
+			t.Logf("%s: skipping, run failed: %v", engineType, err)
+			continue
+		}
+		// At most 2x100 I/Os per 50ms idle period, and at least one burst.
+		if res.IOPS > 4000 || res.TotalIOs < 200 {
+			t.Errorf("%s: %d I/Os, %.0f IOPS in 100 I/O bursts with 50ms idle", engineType, res.TotalIOs, res.IOPS)
+		}
+
+		params.BurstIOs, params.BurstIdle = 0, 0
+		params.ThinkTime = 2 * time.Millisecond
+		if res, err = mustNew(t, engineType).Run(context.Background(), params); err != nil {
+			t.Fatal(err)
+		}
+		// Each worker waits 2ms between its I/Os.
+		if res.IOPS > 1000 || res.TotalIOs < 100 {
+			t.Errorf("%s: %d I/Os, %.0f IOPS with 2ms think time", engineType, res.TotalIOs, res.IOPS)
+		}
+	}
+}
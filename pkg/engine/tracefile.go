@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// traceIO is one I/O of a recorded trace.
+type traceIO struct {
+	at     time.Duration // Since the first I/O of the trace
+	offset int64
+	size   int
+	isRead bool
+}
+
+// loadTrace reads an I/O trace for the replay engine. Two text formats are
+// accepted, detected per line:
+//
+//	CSV:      <seconds>,<offset bytes>,<size bytes>,<R|W>
+//	blkparse: default blkparse output; only queue (Q) events are used
+//
+// Lines that fit neither format (headers, comments, blkparse summaries) are
+// skipped, as are operations other than reads and writes.
+func loadTrace(path string) ([]traceIO, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ios, err := parseTrace(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ios, nil
+}
+
+func parseTrace(r io.Reader) ([]traceIO, error) {
+	var ios []traceIO
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var tio traceIO
+		var ok bool
+		var err error
+		// blkparse lines start with "maj,min", so try that format first.
+		var isEvent bool
+		if tio, ok, isEvent = parseBlkparseLine(line); !isEvent && strings.Contains(line, ",") {
+			tio, ok, err = parseCSVLine(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if ok {
+			ios = append(ios, tio)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ios) == 0 {
+		return nil, fmt.Errorf("no reads or writes found in trace")
+	}
+
+	sort.SliceStable(ios, func(i, j int) bool { return ios[i].at < ios[j].at })
+	first := ios[0].at
+	for i := range ios {
+		ios[i].at -= first
+	}
+	return ios, nil
+}
+
+// parseCSVLine parses "<seconds>,<offset>,<size>,<op>". A line whose first
+// field isn't a number is taken to be a header.
+func parseCSVLine(line string) (traceIO, bool, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return traceIO{}, false, nil
+	}
+	if len(fields) != 4 {
+		return traceIO{}, false, fmt.Errorf("want 4 fields (time,offset,size,op), got %d", len(fields))
+	}
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || offset < 0 {
+		return traceIO{}, false, fmt.Errorf("invalid offset %q", fields[1])
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil || size <= 0 {
+		return traceIO{}, false, fmt.Errorf("invalid size %q", fields[2])
+	}
+	var isRead bool
+	switch strings.ToUpper(fields[3]) {
+	case "R", "READ":
+		isRead = true
+	case "W", "WRITE":
+	default:
+		return traceIO{}, false, nil
+	}
+	return traceIO{at: time.Duration(secs * float64(time.Second)), offset: offset, size: size, isRead: isRead}, true, nil
+}
+
+// parseBlkparseLine parses a blkparse event such as
+//
+//	8,0    3        1     0.000000000   697  Q  WS 223490 + 8 [kjournald]
+//
+// Sectors are 512 bytes regardless of the device's block size. isEvent
+// reports whether line is a blkparse event at all, ok whether it is a usable
+// read or write.
+func parseBlkparseLine(line string) (tio traceIO, ok, isEvent bool) {
+	f := strings.Fields(line)
+	if len(f) < 6 || strings.Count(f[0], ",") != 1 || strings.Contains(strings.Join(f[1:], " "), ",") {
+		return traceIO{}, false, false
+	}
+	secs, err := strconv.ParseFloat(f[3], 64)
+	if err != nil {
+		return traceIO{}, false, false
+	}
+	if len(f) < 10 || f[5] != "Q" || f[8] != "+" {
+		return traceIO{}, false, true
+	}
+	sector, err2 := strconv.ParseInt(f[7], 10, 64)
+	sectors, err3 := strconv.Atoi(f[9])
+	if err2 != nil || err3 != nil || sectors <= 0 {
+		return traceIO{}, false, true
+	}
+	rwbs := f[6]
+	var isRead bool
+	switch {
+	case strings.ContainsAny(rwbs, "DN"):
+		return traceIO{}, false, true // Discard or no data
+	case strings.Contains(rwbs, "R"):
+		isRead = true
+	case strings.Contains(rwbs, "W"):
+	default:
+		return traceIO{}, false, true
+	}
+	return traceIO{at: time.Duration(secs * float64(time.Second)), offset: sector * 512, size: sectors * 512, isRead: isRead}, true, true
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"time"
 )
 
@@ -14,14 +15,77 @@ type Result struct {
 	P99Latency        time.Duration
 	P999Latency       time.Duration
 	TotalIOs          int64
+	Bytes             int64 // Bytes transferred
 	Duration          time.Duration
-	MetricConfidence  float64 // The achieved StdErr/Mean (lower is better)
-	TerminationReason string  // Why the test finished (Timeout, Converged, etc.)
+	MetricConfidence  float64 // The relative error reached under the stop rule (lower is better)
+	TerminationReason string  // Why the test finished (Timeout, "Converged (<stop rule>)", etc.)
+	OfferedIOPS       float64 // Open-loop only: arrival rate that was scheduled (compare with IOPS)
+	Placement         *Placement `json:",omitempty"` // Where workers ran, if Params.CPUs was set
+	CPU               CPUStats   // CPU used during the measurement
+	Series            []SeriesPoint `json:",omitempty"` // Per-interval stats, if Params.SeriesInterval was set
+	Device            *DeviceStats `json:",omitempty"` // What the target's block device did, if it has one
+	NodeDevices       map[string]*DeviceStats `json:",omitempty"` // Cluster runs: Device of each node, by node name
+
+	// Histogram is the full latency distribution (µs) encoded with
+	// EncodeHistogram. Merging results must go through this rather than
+	// averaging the percentile fields above.
+	Histogram string `json:",omitempty"`
+
+	// Per-direction breakdown for mixed workloads.
+	Read  DirStats
+	Write DirStats
+
+	// Flushes issued for Params.FsyncEvery. They are not I/Os: TotalIOs and
+	// IOPS don't include them, and Bytes and Throughput stay zero.
+	Flush DirStats
+
+	// Discards and write-zeroes (Params.DiscardPct, WriteZeroesPct). They
+	// count towards TotalIOs, IOPS and the overall latency, but not towards
+	// Bytes and Throughput, which only cover data transferred.
+	Discard     DirStats
+	WriteZeroes DirStats
+
+	// Async engines only (uring, libaio): the latency of data I/Os split at
+	// the return of the submit call, like fio's slat and clat. Slat is the
+	// time spent queued for submission, batching included, and Clat the time
+	// from there to the completion being seen. Only TotalIOs and the latency
+	// fields are set. In open-loop mode the overall latency also includes
+	// the wait for a free slot, so it can be more than their sum.
+	Slat DirStats
+	Clat DirStats
+
+	// Verify mode only: blocks that passed and failed verification, and the
+	// first few failures.
+	VerifiedBlocks int64
+	VerifyFailures int64
+	VerifyErrors   []VerifyError `json:",omitempty"`
+
+	// Runs with Params.Groups only: each group's result, by name. The fields
+	// above are the totals of all groups.
+	Groups map[string]*Result `json:",omitempty"`
+}
+
+// DirStats contains the metrics for one I/O direction (reads or writes).
+type DirStats struct {
+	IOPS        float64
+	Throughput  float64 // Bytes per second
+	MeanLatency time.Duration
+	P50Latency  time.Duration
+	P95Latency  time.Duration
+	P99Latency  time.Duration
+	P999Latency time.Duration
+	TotalIOs    int64
+	Bytes       int64
+	Histogram   string `json:",omitempty"`
 }
 
 // Engine defines the interface for different I/O execution strategies.
+//
+// Run stops early if ctx is cancelled: the workers are shut down and the
+// result so far is returned, with TerminationReason "Cancelled", along with
+// ctx.Err().
 type Engine interface {
-	Run(params Params) (*Result, error)
+	Run(ctx context.Context, params Params) (*Result, error)
 	NumNodes() int
 }
 
@@ -38,18 +102,116 @@ type TraceMsg struct {
 
 // Params defines the parameters for an I/O workload.
 type Params struct {
-	EngineType string        // "sync" or "uring"
+	EngineType string        // "sync", "uring", "libaio", "replay" or "sim"
 	Path       string        // Path to the device or file
 	BlockSize  int           // Size of each I/O in bytes
+	BSSplit    string        // Mixed block sizes, fio bssplit syntax (e.g. "4k/60:64k/40"); overrides BlockSize
 	Direct     bool          // Use O_DIRECT
 	ReadPct    int           // Percentage of operations that are reads (0-100)
+	DiscardPct int           // Percentage of all operations that are discards (TRIM); ReadPct splits the rest
+	WriteZeroesPct int       // Percentage of all operations that are write-zeroes
 	Rand       bool          // True for random, false for sequential
+	Distribution string      // Random offset distribution, fio syntax (e.g. "zipf:1.2"); empty is uniform
+	Offset     int64         // Start of the I/O region in bytes
+	Length     int64         // Size of the I/O region in bytes; 0 means up to the end
+	WorkingSet int64         // Bytes of the region actually touched, from its start; 0 means all of it
+	Disjoint   bool          // Give each worker its own slice of the region instead of sharing it
 	Workers    int           // Number of concurrent workers (goroutines or async loops)
 	QueueDepth int           // Global target queue depth (token bucket size)
-	MinRuntime time.Duration // Minimum time to run the test
-	MaxRuntime time.Duration // Maximum time to run the test
+	RampTime   time.Duration // Warm-up before measurement starts; I/O runs but isn't recorded
+	MinRuntime time.Duration // Minimum time to run the test, after the ramp
+	MaxRuntime time.Duration // Maximum time to run the test, after the ramp
 	ErrorTarget float64      `json:"error_target"`      // Target standard error / mean (e.g. 0.01 for 1%)
-	
+
+	// StopRule picks how a point converges: "stderr" (default), "batch_means",
+	// "p99_ci", "plateau" or "io_count", which stops after StopIOs I/Os. All
+	// but io_count compare against ErrorTarget; see converge.go.
+	StopRule string
+	StopIOs  int64
+
+	// Written data. Write buffers are zeroed by default, which compressing
+	// and deduplicating devices reduce to nothing. CompressRatio (2 for 2:1,
+	// 1 for incompressible) or DedupePct fill them with random data instead:
+	// each 512 byte chunk is 1/CompressRatio random and the rest zeros, and
+	// DedupePct% of the 4KiB blocks repeat one of a few blocks shared by all
+	// workers. Each buffer is regenerated every RefillEvery writes (0 means
+	// every write), before the I/O is timed.
+	CompressRatio float64
+	DedupePct     int
+	RefillEvery   int
+
+	// SeriesInterval > 0 records Result.Series, IOPS, throughput and latency
+	// percentiles per interval. It is rounded up to the 100ms monitor tick.
+	SeriesInterval time.Duration
+
+	// Open-loop mode: if TargetIOPS > 0, I/Os are issued on a fixed ("fixed")
+	// or exponential ("poisson") arrival schedule instead of as fast as
+	// slots free up, and latency is measured from the scheduled time.
+	TargetIOPS float64
+	Arrival    string
+
+	// SpinWait makes workers spin for the last millisecond before each
+	// scheduled I/O (arrival, end of a think time or replay timestamp)
+	// rather than rely on timers alone, which can wake up a millisecond late
+	// on VMs and charge that to the I/O as latency. Spinning costs up to a
+	// core per worker, which Result.CPU then includes.
+	SpinWait bool
+
+	// Closed-loop pauses. Each worker waits ThinkTime between its I/Os, after
+	// the last one completed and, with several in flight, after the last one
+	// was issued; always ("fixed") or on average ("exp" ThinkDist).
+	// BurstIOs > 0 makes each worker issue that many I/Os at full speed, wait
+	// for them to complete and then idle for BurstIdle. The idle time counts
+	// towards Duration, so IOPS is the average over the bursts.
+	ThinkTime time.Duration
+	ThinkDist string
+	BurstIOs  int
+	BurstIdle time.Duration
+
+	// Trace replay ("replay" engine): a CSV or blkparse trace, and the replay
+	// speed relative to the original timing (0 = as fast as possible).
+	TraceFile   string
+	ReplaySpeed float64
+
+	// Data integrity: "inline" checks every block read against the header
+	// written with it, "pass" additionally re-reads every written block after
+	// the run. Empty disables verification.
+	Verify string
+
+	// Durability. SyncMode opens the target with O_DSYNC ("dsync") or O_SYNC
+	// ("sync"). FsyncEvery > 0 makes each worker flush after every that many
+	// of its writes, with fdatasync instead of fsync if Fdatasync is set.
+	// Flushes are supported by the sync and uring engines.
+	SyncMode   string
+	FsyncEvery int
+	Fdatasync  bool
+
+	// io_uring tuning, ignored by the other engines. The batch sizes only
+	// apply in closed-loop mode; open-loop arrivals are submitted when due.
+	FixedBufs     bool          // Register the I/O buffers and use READ_FIXED/WRITE_FIXED
+	FixedFiles    bool          // Register the target file with the ring
+	SQPoll        bool          // Submit through a kernel SQ polling thread (needs CAP_SYS_NICE)
+	SQPollIdle    time.Duration // Idle time before the SQ thread sleeps; 0 = kernel default
+	IOPoll        bool          // Busy-poll for completions; requires Direct
+	SubmitBatch   int           // SQEs to queue before submitting; 0 or 1 submits right away
+	CompleteBatch int           // Completions to wait for at once; 0 or 1 waits for the first
+
+	// Device model for the "sim" engine; nil uses DefaultSimDevice.
+	Sim *SimDevice `json:",omitempty"`
+
+	// CPUs pins each worker to an OS thread on one CPU, round-robin over a
+	// CPU list ("0-3,8"), the CPUs of a NUMA node ("node:1") or those of the
+	// node the target is attached to ("local"). With a node, worker buffers
+	// are allocated on it too. Empty leaves placement to the OS.
+	CPUs string `json:",omitempty"`
+
+	// Groups, if set, run several workloads against Path at once, e.g. a 4k
+	// random read latency probe next to a sequential writer. Each group is
+	// this Params with the group's fields overriding it; the run stops when
+	// the first foreground group does. Supported by the sync, uring and
+	// libaio engines.
+	Groups []Group `json:",omitempty"`
+
 	TraceChannel chan TraceMsg `json:"-"`
 
 	// Optional callback for real-time progress updates
@@ -3,17 +3,17 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
 	"sync"
-	"sync/atomic"
 	"syscall"
 	"time"
+	"unsafe"
 
-	"github.com/HdrHistogram/hdrhistogram-go"
 	"github.com/godzie44/go-uring/uring"
 	"golang.org/x/sys/unix"
 )
@@ -21,15 +21,74 @@ import (
 type UringEngine struct {
 }
 
+func init() {
+	Register(Registration{
+		Name:        "uring",
+		Description: "io_uring, with optional registered buffers/files, SQPOLL and IOPOLL",
+		Caps:        Capabilities{Async: true, Direct: true},
+		Fio:         "io_uring",
+		New:         func() Engine { return NewUring() },
+		Available: func() error {
+			ring, err := uring.New(2)
+			if err != nil {
+				return err
+			}
+			return ring.Close()
+		},
+	})
+}
+
 func NewUring() *UringEngine {
 	return &UringEngine{}
 }
 
 func (e *UringEngine) NumNodes() int { return 1 }
 
-func (e *UringEngine) Run(params Params) (*Result, error) {
-	if params.BlockSize <= 0 {
-		return nil, fmt.Errorf("invalid block size: %d", params.BlockSize)
+func (e *UringEngine) Run(ctx context.Context, params Params) (*Result, error) {
+	if len(params.Groups) > 0 {
+		return runGroups(ctx, e, params)
+	}
+	sizes, err := newBlockSizes(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseDistribution(params.Distribution); err != nil {
+		return nil, err
+	}
+	v, err := newVerifier(params, sizes)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDiscard(params, "uring", false); err != nil {
+		return nil, err
+	}
+	if err := checkFlush(params, "uring", true); err != nil {
+		return nil, err
+	}
+	if err := checkData(params, "uring", true); err != nil {
+		return nil, err
+	}
+	if err := checkThink(params, "uring", true); err != nil {
+		return nil, err
+	}
+	if err := checkArrival(params); err != nil {
+		return nil, err
+	}
+	ctl, err := newController(params)
+	if err != nil {
+		return nil, err
+	}
+	pl, err := newPlacer(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.IOPoll && !params.Direct {
+		return nil, fmt.Errorf("iopoll requires direct I/O")
+	}
+	if params.IOPoll && params.FsyncEvery > 0 {
+		// A polled ring only takes I/O that can be polled for; the kernel
+		// fails IORING_OP_FSYNC on it with EINVAL.
+		return nil, fmt.Errorf("iopoll can't be combined with fsync")
 	}
 
 	// 1. Sanitize Inputs
@@ -59,10 +118,11 @@ func (e *UringEngine) Run(params Params) (*Result, error) {
 
 	var wg sync.WaitGroup
 	done := make(chan struct{})
-	var opsCounter int64
 	results := make(chan workerResult, numWorkers)
 
-	start := time.Now()
+	// Measurement starts once the ramp is over. Workers keep issuing I/O
+	// during the ramp but don't record it.
+	start := time.Now().Add(params.RampTime)
 
 	for i := 0; i < numWorkers; i++ {
 		workerQD := qdPerWorker
@@ -72,75 +132,26 @@ func (e *UringEngine) Run(params Params) (*Result, error) {
 		wg.Add(1)
 		go func(id int, qd int) {
 			defer wg.Done()
-			results <- e.runUringWorker(id, params, qd, done, &opsCounter)
+			results <- e.runUringWorker(id, params, sizes, v, start, qd, numWorkers, done, ctl, pl)
 		}(i, workerQD)
 	}
 
 	monitorTicker := time.NewTicker(100 * time.Millisecond)
 	defer monitorTicker.Stop()
 
-	var iopsSamples []float64
-	var lastOps int64
-	var lastTime = start
-	var finalRelErr float64
 	var reason string
 
 	for {
 		select {
+		case <-ctx.Done():
+			reason = "Cancelled"
+			goto Finished
 		case <-monitorTicker.C:
 			now := time.Now()
-			elapsed := now.Sub(start)
-			currOps := atomic.LoadInt64(&opsCounter)
-			deltaOps := currOps - lastOps
-			deltaTime := now.Sub(lastTime).Seconds()
-			if deltaTime > 0 {
-				iopsSamples = append(iopsSamples, float64(deltaOps)/deltaTime)
-			}
-			lastOps = currOps
-			lastTime = now
-
-			var mean, stdErr float64
-			if len(iopsSamples) > 0 {
-				mean, stdErr = calculateStats(iopsSamples)
-			}
-			if mean > 0 {
-				finalRelErr = stdErr / mean
+			if now.Before(start) {
+				continue // Still ramping
 			}
-
-			// Calculate Instantaneous IOPS (Last 10 samples = 1 second) for display
-			var instantIOPS float64
-			window := 10
-			if len(iopsSamples) == 0 {
-				instantIOPS = 0
-			} else if len(iopsSamples) < window {
-				instantIOPS = mean
-			} else {
-				sum := 0.0
-				for k := 0; k < window; k++ {
-					sum += iopsSamples[len(iopsSamples)-1-k]
-				}
-				instantIOPS = sum / float64(window)
-			}
-
-			if params.Progress != nil {
-				params.Progress(Result{
-					IOPS:             instantIOPS,
-					MetricConfidence: finalRelErr,
-					Duration:         elapsed,
-					TotalIOs:         currOps,
-				})
-			}
-
-			if elapsed > params.MinRuntime {
-				if len(iopsSamples) > 5 && mean > 0 && params.ErrorTarget > 0 {
-					if finalRelErr <= params.ErrorTarget {
-						reason = "Converged"
-						goto Finished
-					}
-				}
-			}
-			if params.MaxRuntime > 0 && elapsed >= params.MaxRuntime {
-				reason = "Timeout"
+			if reason = ctl.tick(now.Sub(start)); reason != "" {
 				goto Finished
 			}
 		}
@@ -149,21 +160,35 @@ func (e *UringEngine) Run(params Params) (*Result, error) {
 Finished:
 	close(done)
 	wg.Wait()
+	cpu := ctl.cpu()
+	dev := ctl.device()
 	close(results)
 
 	duration := time.Since(start)
 	
 	syncEng := &SyncEngine{}
-	res, err := syncEng.aggregate(results, duration, finalRelErr)
+	res, err := syncEng.aggregate(results, duration, ctl.relErr)
 	if err != nil {
 		return nil, err
 	}
-	res.Throughput = float64(res.TotalIOs*int64(params.BlockSize)) / duration.Seconds()
 	res.TerminationReason = reason
+	res.Placement = pl.placement(params)
+	res.CPU = cpu
+	res.Device = dev
+	res.Series = ctl.finishSeries(duration)
+	if err := finishVerify(ctx, v, params, res); err != nil {
+		return nil, err
+	}
+	if reason == "Cancelled" {
+		return res, ctx.Err()
+	}
 	return res, nil
 }
 
-func (e *UringEngine) runUringWorker(id int, params Params, qd int, done chan struct{}, opsCounter *int64) workerResult {
+func (e *UringEngine) runUringWorker(id int, params Params, sizes blockSizes, v *verifier, measureFrom time.Time, qd int, numWorkers int, done chan struct{}, ctl *controller, pl *placer) workerResult {
+	if err := pl.pin(id); err != nil {
+		return workerResult{err: err}
+	}
 	flags := os.O_RDONLY
 	if params.ReadPct < 100 {
 		flags = os.O_RDWR
@@ -171,6 +196,8 @@ func (e *UringEngine) runUringWorker(id int, params Params, qd int, done chan st
 	if params.Direct {
 		flags |= syscall.O_DIRECT
 	}
+	syncFlag, _ := syncOpenFlag(params.SyncMode)
+	flags |= syncFlag
 
 	f, err := os.OpenFile(params.Path, flags, 0666)
 	if err != nil {
@@ -178,34 +205,65 @@ func (e *UringEngine) runUringWorker(id int, params Params, qd int, done chan st
 	}
 	defer f.Close()
 
-	ring, err := uring.New(uint32(qd))
+	var opts []uring.SetupOption
+	if params.SQPoll {
+		opts = append(opts, uring.WithSQPoll(params.SQPollIdle))
+	}
+	if params.IOPoll {
+		opts = append(opts, uring.WithIOPoll())
+	}
+	ring, err := uring.New(uint32(qd), opts...)
 	if err != nil {
 		return workerResult{err: fmt.Errorf("failed to setup io_uring: %v", err)}
 	}
 	defer ring.Close()
 
-	totalBufSize := params.BlockSize * qd
-	alignedBlock, err := unix.Mmap(-1, 0, totalBufSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	totalBufSize := sizes.max * qd
+	alignedBlock, err := pl.mmap(totalBufSize)
 	if err != nil {
-		return workerResult{err: fmt.Errorf("failed to allocate aligned memory: %v", err)}
+		return workerResult{err: err}
 	}
 	defer unix.Munmap(alignedBlock)
 
+	// With registered files the SQEs name the file by its index (0) in the
+	// ring's table instead of by descriptor.
+	fd := int32(f.Fd())
+	var sqeFlags uint8
+	if params.FixedFiles {
+		if err := ring.RegisterFiles([]int{int(fd)}); err != nil {
+			return workerResult{err: fmt.Errorf("failed to register file: %v", err)}
+		}
+		fd = 0
+		sqeFlags |= uring.SqeFixedFileFlag
+	}
+	// All slots share one mapping, so it is registered as a single buffer.
+	if params.FixedBufs {
+		iov := syscall.Iovec{Base: &alignedBlock[0]}
+		iov.SetLen(totalBufSize)
+		if err := ring.RegisterBuffers([]syscall.Iovec{iov}); err != nil {
+			return workerResult{err: fmt.Errorf("failed to register buffers: %v", err)}
+		}
+	}
+
+	submitBatch := min(max(params.SubmitBatch, 1), qd)
+	completeBatch := min(max(params.CompleteBatch, 1), qd)
+	queued := make([]int, 0, qd) // Slots queued but not yet submitted
+
 	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
 		return workerResult{err: err}
 	}
 	
-	maxBlocks := size / int64(params.BlockSize)
-	if maxBlocks <= 0 {
-		return workerResult{err: fmt.Errorf("file too small for block size")}
+	rg, err := workerRegion(params, sizes, size, id, numWorkers)
+	if err != nil {
+		return workerResult{err: err}
 	}
 
 	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	gen := newDataGen(params, qd, r.Int63())
 
-	var ioCount int64
 	// Use Histogram to avoid OOM
-	hist := hdrhistogram.New(1, 3600000000, 3)
+	wr := newWorkerResult()
 
 	freeSlots := make([]int, qd)
 	for i := 0; i < qd; i++ {
@@ -214,56 +272,160 @@ func (e *UringEngine) runUringWorker(id int, params Params, qd int, done chan st
 	nextFreeIdx := qd
 	
 	startTimes := make([]time.Time, qd)
+	submitTimes := make([]time.Time, qd)
+	intendedTimes := make([]time.Time, qd)
+	slotIsRead := make([]bool, qd)
+	slotOffset := make([]int64, qd)
+	slotSeq := make([]uint64, qd)
+	slotBuf := make([][]byte, qd)
+	slotFlush := make([]bool, qd)
 	inFlight := 0
-	lastOffset := r.Int63n(maxBlocks) * int64(params.BlockSize)
+	writes := 0 // Since the last flush
+	offsets, err := newOffsetGen(params, rg, r.Int63n(rg.blocks), r)
+	if err != nil {
+		return workerResult{err: err}
+	}
+	pace := newPacer(params, id, numWorkers, time.Now(), r)
+	th := newThinker(params, r)
+
+	finish := func() workerResult {
+		if pace != nil {
+			wr.offered += pace.Due(time.Now())
+		}
+		return wr
+	}
+	// submitted stamps the queued slots once the submit call has returned.
+	submitted := func() {
+		now := time.Now()
+		for _, slot := range queued {
+			submitTimes[slot] = now
+		}
+		queued = queued[:0]
+	}
 
 	for {
 		for inFlight < qd && nextFreeIdx > 0 {
+			if pace != nil && pace.Peek().After(time.Now()) {
+				break
+			}
+			if !th.ready(time.Now(), inFlight) {
+				break
+			}
 			nextFreeIdx--
 			slotIdx := freeSlots[nextFreeIdx]
 
-			offset := int64(0)
-			if params.Rand {
-				offset = r.Int63n(maxBlocks) * int64(params.BlockSize)
-			} else {
-				offset = lastOffset
-				lastOffset = (lastOffset + int64(params.BlockSize)) % size
-			}
-
-			isRead := true
-			if params.ReadPct < 100 {
-				if params.ReadPct == 0 || r.Intn(100) >= params.ReadPct {
-					isRead = false
-				}
-			}
+			// checkDiscard leaves only reads and writes.
+			isRead := pickOp(params, r) == opRead
 
-			blockBuf := alignedBlock[slotIdx*params.BlockSize : (slotIdx+1)*params.BlockSize]
+			slotStart := slotIdx * sizes.max
+			blockBuf := alignedBlock[slotStart : slotStart+sizes.pick(isRead, r)]
+			offset := offsets.Next(len(blockBuf))
+			prepStart := time.Now()
+			gen.prepare(blockBuf, slotIdx, isRead)
 			var op uring.Operation
-			if isRead {
-				op = uring.Read(f.Fd(), blockBuf, uint64(offset))
-			} else {
-				op = uring.Write(f.Fd(), blockBuf, uint64(offset))
+			switch {
+			case params.FixedBufs:
+				op = &fixedOp{read: isRead, fd: fd, buf: blockBuf, off: uint64(offset)}
+			case isRead:
+				op = uring.Read(uintptr(fd), blockBuf, uint64(offset))
+			default:
+				op = uring.Write(uintptr(fd), blockBuf, uint64(offset))
 			}
 			
-			err := ring.QueueSQE(op, 0, uint64(slotIdx))
+			err := ring.QueueSQE(op, sqeFlags, uint64(slotIdx))
 			if err != nil {
 				freeSlots[nextFreeIdx] = slotIdx
 				nextFreeIdx++
 				break
 			}
+			if v != nil && !isRead {
+				slotSeq[slotIdx] = v.fill(blockBuf, offset)
+			} else if v != nil {
+				slotSeq[slotIdx] = v.reading(offset)
+			}
 			startTimes[slotIdx] = time.Now()
+			if pace != nil {
+				intended := pace.Next()
+				if !intended.Before(measureFrom) {
+					wr.offered++
+				}
+				// Generating the data isn't part of the I/O's latency.
+				intendedTimes[slotIdx] = intended.Add(startTimes[slotIdx].Sub(prepStart))
+			}
+			slotIsRead[slotIdx] = isRead
+			slotOffset[slotIdx] = offset
+			slotBuf[slotIdx] = blockBuf
 			inFlight++
+			queued = append(queued, slotIdx)
+			th.issued(startTimes[slotIdx])
 		}
 
 		var cqe *uring.CQEvent
-		for {
-			cqe, err = ring.SubmitAndWaitCQEvents(1)
-			if err == nil || !isEINTR(err) {
-				break
+		if pace != nil && inFlight == 0 {
+			if !sleepUntil(pace.Peek(), params.SpinWait, done) {
+				return finish()
+			}
+			continue
+		} else if th != nil && inFlight == 0 {
+			if !sleepUntil(th.next, params.SpinWait, done) {
+				return finish()
+			}
+			continue
+		} else if (pace != nil || th != nil && !th.draining()) && inFlight < qd {
+			// Slots are free but the next arrival isn't due yet, or the
+			// worker is thinking, so wait for completions only until then.
+			if _, err := ring.Submit(); err != nil && !isEINTR(err) {
+				return workerResult{err: err}
+			}
+			submitted()
+			until := th.next
+			if pace != nil {
+				until = pace.Peek()
+			}
+			cqe, err = ring.WaitCQEventsWithTimeout(1, max(time.Until(until), 0))
+			if err != nil && err != syscall.ETIME && !isEINTR(err) {
+				return workerResult{err: err}
+			}
+		} else if pace == nil && len(queued) < submitBatch && inFlight > len(queued) {
+			// Hold the queued SQEs back until the batch is full; earlier
+			// I/Os are still in flight to free up slots.
+			for {
+				cqe, err = ring.WaitCQEvents(uint32(min(completeBatch, inFlight-len(queued))))
+				if err == nil || !isEINTR(err) {
+					break
+				}
+			}
+			if err != nil {
+				return workerResult{err: err}
+			}
+		} else {
+			waitNr := 1
+			if pace == nil {
+				waitNr = min(completeBatch, inFlight)
+			}
+			// Submit separately from the wait so that the submission and
+			// completion latency can be told apart.
+			if len(queued) > 0 {
+				for {
+					_, err = ring.Submit()
+					if err == nil || !isEINTR(err) {
+						break
+					}
+				}
+				if err != nil {
+					return workerResult{err: err}
+				}
+				submitted()
+			}
+			for {
+				cqe, err = ring.WaitCQEvents(uint32(waitNr))
+				if err == nil || !isEINTR(err) {
+					break
+				}
+			}
+			if err != nil {
+				return workerResult{err: err}
 			}
-		}
-		if err != nil {
-			return workerResult{err: err}
 		}
 
 		for cqe != nil {
@@ -272,25 +434,116 @@ func (e *UringEngine) runUringWorker(id int, params Params, qd int, done chan st
 				return workerResult{err: syscall.Errno(-cqe.Res)}
 			}
 			
-			_ = hist.RecordValue(time.Since(startTimes[slotIdx]).Microseconds())
-			ioCount++
-			atomic.AddInt64(opsCounter, 1)
+			ioEnd := time.Now()
+			if slotFlush[slotIdx] {
+				slotFlush[slotIdx] = false
+				if !ioEnd.Before(measureFrom) {
+					wr.recordFlush(ioEnd.Sub(startTimes[slotIdx]).Microseconds())
+				}
+			} else {
+				latStart := startTimes[slotIdx]
+				if pace != nil {
+					latStart = intendedTimes[slotIdx]
+				}
+				if !ioEnd.Before(measureFrom) {
+					us := ioEnd.Sub(latStart).Microseconds()
+					wr.record(slotIsRead[slotIdx], us, int(cqe.Res))
+					wr.recordSplit(startTimes[slotIdx], submitTimes[slotIdx], ioEnd)
+					ctl.record(us, int64(cqe.Res))
+				}
+				if v != nil {
+					v.completed(slotBuf[slotIdx], slotIsRead[slotIdx], slotOffset[slotIdx], slotSeq[slotIdx])
+				}
+				if !slotIsRead[slotIdx] && params.FsyncEvery > 0 {
+					writes++
+				}
+				th.completed(ioEnd)
+			}
+			ring.SeenCQE(cqe)
+
+			// A due flush takes over the slot of the write that made it due.
+			// It covers the writes completed so far, not those in flight.
+			if !slotFlush[slotIdx] && params.FsyncEvery > 0 && writes >= params.FsyncEvery {
+				op := &fsyncOp{fd: fd, datasync: params.Fdatasync}
+				if ring.QueueSQE(op, sqeFlags, uint64(slotIdx)) == nil {
+					writes = 0
+					slotFlush[slotIdx] = true
+					startTimes[slotIdx] = time.Now()
+					queued = append(queued, slotIdx)
+					cqe, _ = ring.PeekCQE()
+					continue
+				}
+			}
 			inFlight--
 			
 			freeSlots[nextFreeIdx] = slotIdx
 			nextFreeIdx++
-			ring.SeenCQE(cqe)
 			cqe, _ = ring.PeekCQE()
 		}
 
 		select {
 		case <-done:
-			return workerResult{ioCount: ioCount, hist: hist}
+			return finish()
 		default:
 		}
 	}
 }
 
+// Opcodes of IORING_OP_READ_FIXED and IORING_OP_WRITE_FIXED, which go-uring
+// doesn't provide operations for.
+const (
+	opReadFixed  uring.OpCode = 4
+	opWriteFixed uring.OpCode = 5
+)
+
+// fixedOp reads or writes buf, which must lie within registered buffer 0.
+type fixedOp struct {
+	read bool
+	fd   int32
+	buf  []byte
+	off  uint64
+}
+
+func (op *fixedOp) Code() uring.OpCode {
+	if op.read {
+		return opReadFixed
+	}
+	return opWriteFixed
+}
+
+func (op *fixedOp) PrepSQE(sqe *uring.SQEntry) {
+	*sqe = uring.SQEntry{
+		OpCode: uint8(op.Code()),
+		Fd:     op.fd,
+		Off:    op.off,
+		Addr:   uint64(uintptr(unsafe.Pointer(&op.buf[0]))),
+		Len:    uint32(len(op.buf)),
+		BufIG:  0, // Buffer index
+	}
+}
+
+// IORING_OP_FSYNC and its IORING_FSYNC_DATASYNC flag, which go-uring
+// doesn't provide an operation for.
+const (
+	opFsync       uring.OpCode = 3
+	fsyncDatasync uint32       = 1
+)
+
+// fsyncOp is an fsync, or fdatasync if datasync is set, of fd.
+type fsyncOp struct {
+	fd       int32
+	datasync bool
+}
+
+func (op *fsyncOp) Code() uring.OpCode { return opFsync }
+
+func (op *fsyncOp) PrepSQE(sqe *uring.SQEntry) {
+	*sqe = uring.SQEntry{OpCode: uint8(opFsync), Fd: op.fd}
+	if op.datasync {
+		sqe.OpcodeFlags = fsyncDatasync
+	}
+}
+
 func isEINTR(err error) bool {
 	if err == nil {
 		return false
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"math"
 	"os"
 	"testing"
@@ -42,7 +43,7 @@ func TestUringConsistency(t *testing.T) {
 	// Run 3 times and check variance
 	var results []*Result
 	for i := 0; i < 3; i++ {
-		res, err := eng.Run(params)
+		res, err := eng.Run(context.Background(), params)
 		if err != nil {
 			t.Fatalf("Run %d failed: %v", i, err)
 		}
@@ -88,7 +89,7 @@ func TestUringHighQD(t *testing.T) {
 		ErrorTarget: 0.1,
 	}
 
-	res, err := eng.Run(params)
+	res, err := eng.Run(context.Background(), params)
 	if err != nil {
 		t.Fatalf("Stress test failed: %v", err)
 	}
@@ -96,3 +97,60 @@ func TestUringHighQD(t *testing.T) {
 		t.Errorf("Extremely low IOPS (%f) in stress test", res.IOPS)
 	}
 }
+
+// TestUringOptions runs with the registered buffer/file and batching knobs,
+// with verification on so misplaced fixed-buffer I/O would show up.
+func TestUringOptions(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-uring-opts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(10 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	cases := []struct {
+		name   string
+		modify func(*Params)
+	}{
+		{"fixed-bufs", func(p *Params) { p.FixedBufs = true }},
+		{"fixed-files", func(p *Params) { p.FixedFiles = true }},
+		{"fixed-both", func(p *Params) { p.FixedBufs, p.FixedFiles = true, true }},
+		{"batched", func(p *Params) { p.SubmitBatch, p.CompleteBatch = 8, 4 }},
+		{"batched-fixed", func(p *Params) { p.FixedBufs, p.SubmitBatch, p.CompleteBatch = true, 16, 16 }},
+	}
+	for _, c := range cases {
+		params := Params{
+			EngineType: "uring",
+			Path:       tmpFile.Name(),
+			BSSplit:    "4k/50:16k/50",
+			ReadPct:    50,
+			Rand:       true,
+			Workers:    2,
+			QueueDepth: 32,
+			MinRuntime: 200 * time.Millisecond,
+			MaxRuntime: 300 * time.Millisecond,
+			Verify:     "pass",
+		}
+		c.modify(&params)
+		res, err := NewUring().Run(context.Background(), params)
+		if err != nil {
+			t.Fatalf("%s: Run failed: %v", c.name, err)
+		}
+		if res.TotalIOs <= 0 {
+			t.Errorf("%s: no I/O completed", c.name)
+		}
+		if res.VerifyFailures != 0 {
+			t.Errorf("%s: %d verify failures: %v", c.name, res.VerifyFailures, res.VerifyErrors)
+		}
+	}
+
+	if _, err := NewUring().Run(context.Background(), Params{Path: tmpFile.Name(), BlockSize: 4096, IOPoll: true}); err == nil {
+		t.Errorf("expected iopoll without direct I/O to fail")
+	}
+	if _, err := NewUring().Run(context.Background(), Params{Path: tmpFile.Name(), BlockSize: 4096, IOPoll: true, Direct: true, FsyncEvery: 4}); err == nil {
+		t.Errorf("expected iopoll with fsync to fail")
+	}
+}
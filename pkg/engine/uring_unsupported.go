@@ -3,18 +3,30 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 )
 
 type UringEngine struct {
 }
 
+func init() {
+	Register(Registration{
+		Name:        "uring",
+		Description: "io_uring (Linux only)",
+		Caps:        Capabilities{Async: true, Direct: true},
+		Fio:         "io_uring",
+		New:         func() Engine { return NewUring() },
+		Available:   func() error { return fmt.Errorf("io_uring is only supported on Linux") },
+	})
+}
+
 func NewUring() *UringEngine {
 	return &UringEngine{}
 }
 
 func (e *UringEngine) NumNodes() int { return 1 }
 
-func (e *UringEngine) Run(params Params) (*Result, error) {
+func (e *UringEngine) Run(ctx context.Context, params Params) (*Result, error) {
 	return nil, fmt.Errorf("uring engine is only supported on Linux")
 }
@@ -0,0 +1,369 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Verify modes (Params.Verify):
+//
+//	"inline"  every read is checked against the header of the block it read
+//	"pass"    inline checks, plus a read-back of every written block after the
+//	          run that also catches lost (stale) writes
+//
+// In both modes each written block starts with a header followed by a
+// pseudo-random pattern, and a CRC32C that covers both:
+//
+//	[0:8]   magic
+//	[8:16]  offset the block was written to
+//	[16:24] sequence number of the write
+//	[24:32] run seed
+//	[32:36] length of the write
+//	[36:40] CRC32C of the block, excluding these 4 bytes
+//	[40:]   pattern derived from seed, sequence and offset
+//
+// With mixed block sizes a read may be shorter than the write it lands on;
+// such reads can't be checksummed and are skipped. A read that overlapped a
+// write to the same block may return a mix of old and new data, so a
+// mismatch in one is not reported either.
+//
+// The verifier remembers every block written during the run, in both modes,
+// so its memory grows with the part of the target written: about 100 bytes
+// per block, or 25MiB per GiB written in 4KiB blocks.
+const (
+	verifyMagic      = 0x594652564c544f4a // "JOLTVRFY"
+	verifyHeaderSize = 40
+
+	// maxVerifyErrors caps how many mismatches are reported individually.
+	maxVerifyErrors = 100
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// VerifyError describes one block that failed verification.
+type VerifyError struct {
+	Offset int64
+	Reason string
+}
+
+// verifier fills write buffers and checks read-back data in verify mode. It
+// is shared by all workers of a run.
+type verifier struct {
+	seed    uint64
+	mode    string
+	maxSize int
+	seq     uint64 // Atomic
+	failed  int64  // Atomic
+	ok      int64  // Atomic
+
+	mu     sync.Mutex
+	blocks map[int64]*blockState
+	errors []VerifyError
+}
+
+// blockState remembers which writes to a block may legitimately be the last
+// one. Normally that's the last write to complete, but if writes to the same
+// block overlapped the device may have applied them in either order.
+type blockState struct {
+	inflight   int
+	overlapped bool
+	accept     []uint64
+	size       int    // Largest write seen
+	last       uint64 // Sequence number of the last write started
+}
+
+// newVerifier returns nil if verification is off.
+func newVerifier(params Params, sizes blockSizes) (*verifier, error) {
+	switch params.Verify {
+	case "":
+		return nil, nil
+	case "inline", "pass":
+	default:
+		return nil, fmt.Errorf("unknown verify mode %q (want 'inline' or 'pass')", params.Verify)
+	}
+	if sizes.min < verifyHeaderSize {
+		return nil, fmt.Errorf("block size %d too small for verify header", sizes.min)
+	}
+	v := &verifier{
+		seed:    uint64(time.Now().UnixNano()) ^ rand.Uint64(),
+		mode:    params.Verify,
+		maxSize: sizes.max,
+		blocks:  make(map[int64]*blockState),
+	}
+	return v, nil
+}
+
+// fill writes a fresh header and pattern for a write of buf at offset. The
+// returned sequence number must be passed to written once the write is done.
+func (v *verifier) fill(buf []byte, offset int64) uint64 {
+	v.mu.Lock()
+	seq := atomic.AddUint64(&v.seq, 1)
+	st := v.blocks[offset]
+	if st == nil {
+		st = &blockState{}
+		v.blocks[offset] = st
+	}
+	st.inflight++
+	st.size = max(st.size, len(buf))
+	st.last = seq
+	if st.inflight > 1 {
+		st.overlapped = true
+	}
+	v.mu.Unlock()
+
+	binary.LittleEndian.PutUint64(buf[0:], verifyMagic)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(offset))
+	binary.LittleEndian.PutUint64(buf[16:], seq)
+	binary.LittleEndian.PutUint64(buf[24:], v.seed)
+	binary.LittleEndian.PutUint32(buf[32:], uint32(len(buf)))
+	fillPattern(buf[verifyHeaderSize:], v.seed^seq*0x9e3779b97f4a7c15^uint64(offset))
+	binary.LittleEndian.PutUint32(buf[36:], blockChecksum(buf))
+	return seq
+}
+
+// racedRead is the stamp of a read issued while a write to its block was in
+// flight.
+const racedRead = math.MaxUint64
+
+// reading returns the stamp of a read of offset about to be issued, to be
+// passed to completed once it is done.
+func (v *verifier) reading(offset int64) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if st := v.blocks[offset]; st != nil && st.inflight > 0 {
+		return racedRead
+	}
+	return atomic.LoadUint64(&v.seq)
+}
+
+// raced reports whether the read of offset with the given stamp overlapped a
+// write to the block.
+func (v *verifier) raced(offset int64, stamp uint64) bool {
+	if stamp == racedRead {
+		return true
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	st := v.blocks[offset]
+	return st != nil && st.last > stamp
+}
+
+// written records that the write with sequence seq to offset completed.
+func (v *verifier) written(offset int64, seq uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	st := v.blocks[offset]
+	st.inflight--
+	if st.overlapped {
+		st.accept = append(st.accept, seq)
+	} else {
+		st.accept = append(st.accept[:0], seq)
+	}
+	if st.inflight == 0 {
+		st.overlapped = false
+	}
+}
+
+// completed handles a finished I/O of buf at offset. seq is the value fill
+// returned for writes, and reading for reads.
+func (v *verifier) completed(buf []byte, isRead bool, offset int64, seq uint64) {
+	if isRead {
+		v.check(buf, offset, seq)
+	} else {
+		v.written(offset, seq)
+	}
+}
+
+// check verifies that buf, read from offset with the given stamp, is
+// internally consistent. Blocks without a header from this run are skipped
+// if the run never wrote them, and reported otherwise. Reads shorter than
+// the write they hit are skipped, as are mismatches in reads that raced a
+// write.
+func (v *verifier) check(buf []byte, offset int64, stamp uint64) {
+	ours := binary.LittleEndian.Uint64(buf[0:]) == verifyMagic && binary.LittleEndian.Uint64(buf[24:]) == v.seed
+	if !ours && !v.wrote(offset) {
+		return
+	}
+	if ours && int(binary.LittleEndian.Uint32(buf[32:])) > len(buf) {
+		return
+	}
+	if reason := v.inspect(buf, offset); reason != "" {
+		if !v.raced(offset, stamp) {
+			v.fail(offset, reason)
+		}
+		return
+	}
+	atomic.AddInt64(&v.ok, 1)
+}
+
+// wrote reports whether a write to offset has completed during the run.
+func (v *verifier) wrote(offset int64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	st := v.blocks[offset]
+	return st != nil && len(st.accept) > 0
+}
+
+// inspect returns why buf is not a valid block for offset, or "". buf may
+// extend past the end of the block.
+func (v *verifier) inspect(buf []byte, offset int64) string {
+	if got := binary.LittleEndian.Uint64(buf[0:]); got != verifyMagic {
+		return "missing header"
+	}
+	if got := binary.LittleEndian.Uint64(buf[24:]); got != v.seed {
+		return fmt.Sprintf("seed mismatch (got %#x)", got)
+	}
+	if got := int64(binary.LittleEndian.Uint64(buf[8:])); got != offset {
+		return fmt.Sprintf("misplaced block (header offset %d)", got)
+	}
+	n := int(binary.LittleEndian.Uint32(buf[32:]))
+	if n < verifyHeaderSize || n > len(buf) {
+		return fmt.Sprintf("bad length %d", n)
+	}
+	if got, want := binary.LittleEndian.Uint32(buf[36:]), blockChecksum(buf[:n]); got != want {
+		return fmt.Sprintf("checksum mismatch (got %#08x, want %#08x)", got, want)
+	}
+	return ""
+}
+
+func (v *verifier) fail(offset int64, reason string) {
+	atomic.AddInt64(&v.failed, 1)
+	v.mu.Lock()
+	if len(v.errors) < maxVerifyErrors {
+		v.errors = append(v.errors, VerifyError{Offset: offset, Reason: reason})
+	}
+	v.mu.Unlock()
+}
+
+// pass re-reads every block written during the run and checks that it holds
+// one of the writes that could have been the last one. It must only be
+// called once all I/O has finished.
+func (v *verifier) pass(params Params) error {
+	if v.mode != "pass" {
+		return nil
+	}
+	flags := os.O_RDONLY
+	if params.Direct {
+		flags |= O_DIRECT
+	}
+	f, err := os.OpenFile(params.Path, flags, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mem, err := unix.Mmap(-1, 0, v.maxSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return fmt.Errorf("failed to allocate aligned memory: %v", err)
+	}
+	defer unix.Munmap(mem)
+
+	offsets := make([]int64, 0, len(v.blocks))
+	for off := range v.blocks {
+		offsets = append(offsets, off)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	for _, off := range offsets {
+		st := v.blocks[off]
+		if len(st.accept) == 0 {
+			continue // Never completed, e.g. a write that failed
+		}
+		buf := mem[:st.size]
+		if _, err := f.ReadAt(buf, off); err != nil {
+			return fmt.Errorf("verify read at %d failed: %v", off, err)
+		}
+		if reason := v.inspect(buf, off); reason != "" {
+			v.fail(off, reason)
+			continue
+		}
+		// Writes still in flight when the run stopped may or may not have
+		// landed, so any of them is acceptable too.
+		seq := binary.LittleEndian.Uint64(buf[16:])
+		found := st.inflight > 0
+		for _, s := range st.accept {
+			if s == seq {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(off, fmt.Sprintf("stale data (sequence %d, expected %d)", seq, st.accept[len(st.accept)-1]))
+			continue
+		}
+		atomic.AddInt64(&v.ok, 1)
+	}
+	return nil
+}
+
+// report copies the verification outcome into res.
+func (v *verifier) report(res *Result) {
+	res.VerifiedBlocks = atomic.LoadInt64(&v.ok)
+	res.VerifyFailures = atomic.LoadInt64(&v.failed)
+	v.mu.Lock()
+	res.VerifyErrors = append([]VerifyError(nil), v.errors...)
+	v.mu.Unlock()
+}
+
+func blockChecksum(buf []byte) uint32 {
+	crc := crc32.Update(0, crc32c, buf[:36])
+	return crc32.Update(crc, crc32c, buf[verifyHeaderSize:])
+}
+
+// fillPattern fills buf with an xorshift sequence started from seed.
+func fillPattern(buf []byte, seed uint64) {
+	x := seed | 1
+	i := 0
+	for ; i+8 <= len(buf); i += 8 {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		binary.LittleEndian.PutUint64(buf[i:], x)
+	}
+	for ; i < len(buf); i++ {
+		buf[i] = byte(x >> (8 * (i % 8)))
+	}
+}
+
+// finishVerify runs the read-back pass if one was requested, unless ctx is
+// done, and records the outcome in res. v may be nil.
+func finishVerify(ctx context.Context, v *verifier, params Params, res *Result) error {
+	if v == nil {
+		return nil
+	}
+	if ctx.Err() == nil {
+		if err := v.pass(params); err != nil {
+			return err
+		}
+	}
+	v.report(res)
+	return nil
+}
+
+// MergeVerify adds up the verification outcome of rs into dst.
+func MergeVerify(dst *Result, rs ...*Result) {
+	for _, r := range rs {
+		if r == nil {
+			continue
+		}
+		dst.VerifiedBlocks += r.VerifiedBlocks
+		dst.VerifyFailures += r.VerifyFailures
+		for _, e := range r.VerifyErrors {
+			if len(dst.VerifyErrors) >= maxVerifyErrors {
+				break
+			}
+			dst.VerifyErrors = append(dst.VerifyErrors, e)
+		}
+	}
+}
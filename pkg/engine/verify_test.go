@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyRun(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Truncate(1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	for _, engineType := range []string{"sync", "uring", "libaio"} {
+		params := Params{
+			EngineType: engineType,
+			Path:       tmpFile.Name(),
+			BlockSize:  4096,
+			ReadPct:    50,
+			Rand:       true,
+			Workers:    2,
+			QueueDepth: 8,
+			MinRuntime: 100 * time.Millisecond,
+			MaxRuntime: 200 * time.Millisecond,
+			Verify:     "pass",
+		}
+		result, err := mustNew(t, engineType).Run(context.Background(), params)
+		if err != nil {
+			t.Logf("%s: skipping, run failed: %v", engineType, err)
+			continue
+		}
+		if result.VerifiedBlocks <= 0 {
+			t.Errorf("%s: expected verified blocks, got %d", engineType, result.VerifiedBlocks)
+		}
+		if result.VerifyFailures != 0 {
+			t.Errorf("%s: expected no failures, got %d: %v", engineType, result.VerifyFailures, result.VerifyErrors)
+		}
+	}
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	params := Params{BlockSize: 4096, Verify: "pass"}
+	sizes, _ := newBlockSizes(params)
+	v, err := newVerifier(params, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+
+	v.written(8192, v.fill(buf, 8192))
+	v.check(buf, 8192, v.reading(8192))
+	if v.ok != 1 || v.failed != 0 {
+		t.Fatalf("good block: ok=%d failed=%d", v.ok, v.failed)
+	}
+
+	// Same data read back from the wrong place.
+	v.check(buf, 4096, v.reading(4096))
+	buf[100] ^= 1
+	v.check(buf, 8192, v.reading(8192))
+	if v.failed != 2 {
+		t.Fatalf("expected 2 failures, got %d: %v", v.failed, v.errors)
+	}
+	if v.errors[0].Offset != 4096 || v.errors[1].Offset != 8192 {
+		t.Errorf("wrong failure offsets: %v", v.errors)
+	}
+
+	// Blocks not written by this run are skipped.
+	v.check(make([]byte, 4096), 0, v.reading(0))
+	if v.failed != 2 {
+		t.Errorf("unwritten block counted as failure")
+	}
+
+	// A written block that reads back zeroed or from a previous run is not.
+	stale := make([]byte, 4096)
+	v.check(stale, 8192, v.reading(8192))
+	other, _ := newVerifier(params, sizes)
+	other.fill(stale, 8192)
+	v.check(stale, 8192, v.reading(8192))
+	if v.failed != 4 || v.errors[2].Reason != "missing header" || !strings.HasPrefix(v.errors[3].Reason, "seed mismatch") {
+		t.Fatalf("lost writes not reported: %v", v.errors)
+	}
+
+	// A read that overlapped a write to its block may see a mix of both,
+	// whether the write started before or during the read.
+	stamp := v.reading(8192)
+	seq := v.fill(make([]byte, 4096), 8192)
+	v.check(buf, 8192, stamp)
+	v.check(buf, 8192, v.reading(8192))
+	v.written(8192, seq)
+	if v.failed != 4 {
+		t.Errorf("torn read of a block being written counted as failure")
+	}
+}
+
+func TestVerifyPassDetectsStaleData(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "jolt-test-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	params := Params{Path: tmpFile.Name(), BlockSize: 4096, Verify: "pass"}
+	sizes, _ := newBlockSizes(params)
+	v, err := newVerifier(params, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two writes to the same block, but only the first reaches the file.
+	old := make([]byte, 4096)
+	seq := v.fill(old, 0)
+	if _, err := tmpFile.WriteAt(old, 0); err != nil {
+		t.Fatal(err)
+	}
+	v.written(0, seq)
+	seq = v.fill(make([]byte, 4096), 0)
+	v.written(0, seq)
+
+	var res Result
+	if err := finishVerify(context.Background(), v, params, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.VerifyFailures != 1 || len(res.VerifyErrors) != 1 || res.VerifyErrors[0].Offset != 0 {
+		t.Fatalf("expected one stale block at 0, got %+v", res)
+	}
+	t.Logf("reason: %s", res.VerifyErrors[0].Reason)
+}
@@ -3,9 +3,12 @@ package fio
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/HdrHistogram/hdrhistogram-go"
 	"github.com/runningwild/jolt/pkg/engine"
 )
 
@@ -16,26 +19,160 @@ func GenerateJob(p engine.Params) string {
 	sb.WriteString("[global]\n")
 	
 	// Engine mapping
-	switch p.EngineType {
-	case "uring":
-		sb.WriteString("ioengine=io_uring\n")
-	case "libaio":
-		sb.WriteString("ioengine=libaio\n")
-	case "sync":
-		sb.WriteString("ioengine=sync\n")
-	default:
+	if r, ok := engine.Lookup(p.EngineType); ok && r.Fio != "" {
+		sb.WriteString(fmt.Sprintf("ioengine=%s\n", r.Fio))
+	} else {
 		sb.WriteString("ioengine=libaio\n") // Default fallback
 	}
 
 	sb.WriteString(fmt.Sprintf("filename=%s\n", p.Path))
-	sb.WriteString(fmt.Sprintf("bs=%d\n", p.BlockSize))
-	
 	if p.Direct {
 		sb.WriteString("direct=1\n")
 	} else {
 		sb.WriteString("direct=0\n")
 	}
 
+	// fio can't mix trims into reads and writes, and has no write-zeroes
+	if p.DiscardPct > 0 || p.WriteZeroesPct > 0 {
+		sb.WriteString(fmt.Sprintf("; not representable in fio: discard_pct=%d write_zeroes_pct=%d\n", p.DiscardPct, p.WriteZeroesPct))
+	}
+
+	writeWorkload(&sb, p)
+
+	// Think time and bursts. fio has one thinktime, taken after every
+	// thinktime_blocks I/Os, so only one of them can be expressed.
+	switch {
+	case p.BurstIOs > 0:
+		sb.WriteString(fmt.Sprintf("thinktime=%d\n", p.BurstIdle.Microseconds()))
+		sb.WriteString(fmt.Sprintf("thinktime_blocks=%d\n", p.BurstIOs))
+		if p.ThinkTime > 0 {
+			sb.WriteString(fmt.Sprintf("; not representable in fio: think_time=%v with bursts\n", p.ThinkTime))
+		}
+	case p.ThinkTime > 0:
+		sb.WriteString(fmt.Sprintf("thinktime=%d\n", p.ThinkTime.Microseconds()))
+		if p.ThinkDist == "exp" {
+			sb.WriteString("; not representable in fio: think_dist=exp (thinktime is its mean)\n")
+		}
+	}
+
+	// Durability
+	if p.SyncMode != "" {
+		sb.WriteString(fmt.Sprintf("sync=%s\n", p.SyncMode))
+	}
+	if p.FsyncEvery > 0 {
+		if p.Fdatasync {
+			sb.WriteString(fmt.Sprintf("fdatasync=%d\n", p.FsyncEvery))
+		} else {
+			sb.WriteString(fmt.Sprintf("fsync=%d\n", p.FsyncEvery))
+		}
+	}
+
+	// Written data. fio can only refill on every write or never.
+	if p.CompressRatio > 0 || p.DedupePct > 0 {
+		ratio := max(p.CompressRatio, 1)
+		sb.WriteString(fmt.Sprintf("buffer_compress_percentage=%d\n", int(math.Round(100*(1-1/ratio)))))
+		sb.WriteString("buffer_compress_chunk=512\n")
+		if p.DedupePct > 0 {
+			sb.WriteString(fmt.Sprintf("dedupe_percentage=%d\n", p.DedupePct))
+		}
+		if p.RefillEvery <= 1 {
+			sb.WriteString("refill_buffers\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("; not representable in fio: refill_every=%d\n", p.RefillEvery))
+		}
+	}
+
+	// io_uring knobs. fio has no setting for the SQ thread idle time.
+	if p.EngineType == "uring" {
+		if p.FixedBufs {
+			sb.WriteString("fixedbufs=1\n")
+		}
+		if p.FixedFiles {
+			sb.WriteString("registerfiles=1\n")
+		}
+		if p.SQPoll {
+			sb.WriteString("sqthread_poll=1\n")
+		}
+		if p.IOPoll {
+			sb.WriteString("hipri=1\n")
+		}
+	}
+	if p.SubmitBatch > 1 {
+		sb.WriteString(fmt.Sprintf("iodepth_batch_submit=%d\n", p.SubmitBatch))
+	}
+	if p.CompleteBatch > 1 {
+		sb.WriteString(fmt.Sprintf("iodepth_batch_complete_min=%d\n", p.CompleteBatch))
+	}
+	
+	// Data verification. fio checks writes after the write phase by default;
+	// verify_backlog makes it check them while the job is running instead.
+	if p.Verify != "" && p.ReadPct < 100 {
+		sb.WriteString("verify=crc32c\n")
+		if p.Verify == "inline" {
+			sb.WriteString("verify_backlog=1\n")
+		}
+	}
+	
+	// CPU placement. cpus_allowed_policy=split gives each job one CPU of the
+	// list, like Jolt does with workers; fio can't find the target's node.
+	switch {
+	case p.CPUs == "local":
+		sb.WriteString("; not representable in fio: cpus=local (use numa_cpu_nodes with the target's node)\n")
+	case strings.HasPrefix(p.CPUs, "node:"):
+		node := strings.TrimPrefix(p.CPUs, "node:")
+		sb.WriteString(fmt.Sprintf("numa_cpu_nodes=%s\n", node))
+		sb.WriteString(fmt.Sprintf("numa_mem_policy=bind:%s\n", node))
+	case p.CPUs != "":
+		sb.WriteString(fmt.Sprintf("cpus_allowed=%s\n", p.CPUs))
+		sb.WriteString("cpus_allowed_policy=split\n")
+	}
+
+	// FIO needs separate threads if numjobs > 1
+	if p.Workers > 1 {
+		sb.WriteString("group_reporting\n")
+	}
+
+	// Runtime
+	// FIO time_based requires a runtime
+	// We use MaxRuntime from params
+	dur := p.MaxRuntime
+	if dur == 0 { dur = 10 * time.Second }
+	
+	sb.WriteString("time_based\n")
+	sb.WriteString(fmt.Sprintf("runtime=%ds\n", int(dur.Seconds())))
+	// fio has no convergence test; a fixed I/O count is the one stop rule it
+	// can express, split across jobs.
+	if p.StopRule == "io_count" && p.StopIOs > 0 && p.Workers > 0 {
+		sb.WriteString(fmt.Sprintf("number_ios=%d\n", p.StopIOs/int64(p.Workers)))
+	}
+	if p.RampTime > 0 {
+		sb.WriteString(fmt.Sprintf("ramp_time=%dms\n", p.RampTime.Milliseconds()))
+	}
+
+	// To get JSON output matching our needs
+	if len(p.Groups) == 0 {
+		sb.WriteString("\n[jolt_job]\n")
+		return sb.String()
+	}
+
+	// Each group is a job section of its own, reported separately. fio
+	// runs them all for the whole runtime, background groups included.
+	for _, g := range p.Groups {
+		sb.WriteString(fmt.Sprintf("\n[%s]\nnew_group\n", g.Name))
+		writeWorkload(&sb, p.GroupParams(g))
+	}
+	return sb.String()
+}
+
+// writeWorkload writes the options that describe the I/O pattern of p, which
+// a job section can override for a group.
+func writeWorkload(sb *strings.Builder, p engine.Params) {
+	sb.WriteString(fmt.Sprintf("bs=%d\n", p.BlockSize))
+	if p.BSSplit != "" {
+		// Same syntax as fio, including the optional ",<writes>" part
+		sb.WriteString(fmt.Sprintf("bssplit=%s\n", p.BSSplit))
+	}
+
 	// Read/Write Mix
 	if p.ReadPct == 100 {
 		if p.Rand {
@@ -58,6 +195,31 @@ func GenerateJob(p engine.Params) string {
 		sb.WriteString(fmt.Sprintf("rwmixread=%d\n", p.ReadPct))
 	}
 
+	// fio uses the same syntax for random_distribution
+	if p.Rand && p.Distribution != "" && p.Distribution != "uniform" {
+		sb.WriteString(fmt.Sprintf("random_distribution=%s\n", p.Distribution))
+	}
+
+	// I/O region. fio's size is per job, so a disjoint split becomes
+	// size=offset_increment=<slice>.
+	if p.Offset > 0 {
+		sb.WriteString(fmt.Sprintf("offset=%d\n", p.Offset))
+	}
+	regionSize := p.Length
+	if p.WorkingSet > 0 && (regionSize == 0 || p.WorkingSet < regionSize) {
+		regionSize = p.WorkingSet
+	}
+	if p.Disjoint && p.Workers > 1 {
+		if regionSize > 0 {
+			slice := regionSize / int64(p.Workers) / int64(p.BlockSize) * int64(p.BlockSize)
+			sb.WriteString(fmt.Sprintf("size=%d\noffset_increment=%d\n", slice, slice))
+		} else {
+			sb.WriteString(fmt.Sprintf("size=%d%%\noffset_increment=%d%%\n", 100/p.Workers, 100/p.Workers))
+		}
+	} else if regionSize > 0 {
+		sb.WriteString(fmt.Sprintf("size=%d\n", regionSize))
+	}
+
 	// Concurrency
 	// Jolt "Workers" -> FIO "numjobs"
 	// Jolt "QueueDepth" -> Total slots per node.
@@ -78,23 +240,13 @@ func GenerateJob(p engine.Params) string {
 	sb.WriteString(fmt.Sprintf("numjobs=%d\n", p.Workers))
 	sb.WriteString(fmt.Sprintf("iodepth=%d\n", iodepth))
 	
-	// FIO needs separate threads if numjobs > 1
-	if p.Workers > 1 {
-		sb.WriteString("group_reporting\n")
+	// Open-loop rate, split across jobs like Jolt splits it across workers
+	if p.TargetIOPS > 0 && p.Workers > 0 {
+		sb.WriteString(fmt.Sprintf("rate_iops=%d\n", int(p.TargetIOPS)/p.Workers))
+		if p.Arrival == "poisson" {
+			sb.WriteString("rate_process=poisson\n")
+		}
 	}
-
-	// Runtime
-	// FIO time_based requires a runtime
-	// We use MaxRuntime from params
-	dur := p.MaxRuntime
-	if dur == 0 { dur = 10 * time.Second }
-	
-	sb.WriteString("time_based\n")
-	sb.WriteString(fmt.Sprintf("runtime=%ds\n", int(dur.Seconds())))
-
-	// To get JSON output matching our needs
-	sb.WriteString("\n[jolt_job]\n")
-	return sb.String()
 }
 
 // Structures for parsing FIO JSON output
@@ -104,12 +256,15 @@ type FioOutput struct {
 }
 
 type FioJob struct {
+	JobName string `json:"jobname"`
 	Read  FioStats `json:"read"`
 	Write FioStats `json:"write"`
 }
 
 type FioStats struct {
 	IOPS      float64     `json:"iops"`
+	BwBytes   float64     `json:"bw_bytes"`
+	IOBytes   int64       `json:"io_bytes"`
 	TotalIOS  int64       `json:"total_ios"`
 	ClatNs    FioLatStats `json:"clat_ns"` // Completion latency
 }
@@ -117,6 +272,7 @@ type FioStats struct {
 type FioLatStats struct {
 	Mean       float64           `json:"mean"`
 	Percentile map[string]uint64 `json:"percentile"` // e.g. "99.000000": 1234
+	Bins       map[string]uint64 `json:"bins"`       // latency (ns) -> count; only with --output-format=json+
 }
 
 func ParseOutput(jsonData []byte, duration time.Duration) (*engine.Result, error) {
@@ -129,27 +285,56 @@ func ParseOutput(jsonData []byte, duration time.Duration) (*engine.Result, error
 	if len(jobs) == 0 {
 		jobs = out.ClientStats
 	}
+	res, err := parseJobs(jobs, duration)
+	if err != nil {
+		return nil, err
+	}
 
+	// Jolt groups are job sections of their own (see GenerateJob).
+	byName := make(map[string][]FioJob)
+	for _, j := range jobs {
+		byName[j.JobName] = append(byName[j.JobName], j)
+	}
+	if len(byName) > 1 {
+		res.Groups = make(map[string]*engine.Result)
+		for name, js := range byName {
+			if res.Groups[name], err = parseJobs(js, duration); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseJobs sums the results of jobs.
+func parseJobs(jobs []FioJob, duration time.Duration) (*engine.Result, error) {
 	res := &engine.Result{
 		Duration: duration,
 	}
 
 	// FIO with group_reporting should return 1 job summarizing everything.
-	// If multiple jobs, we sum/average.
+	// If multiple jobs, we sum counters and merge the latency bins of every
+	// job and direction into one histogram.
 	
 	var totalReadIOs, totalWriteIOs int64
 	var totalReadIOPS, totalWriteIOPS float64
+	var totalReadBW, totalWriteBW float64
+	var totalReadBytes, totalWriteBytes int64
+	readHist := engine.NewHistogram()
+	writeHist := engine.NewHistogram()
 	
-	// Helper to parse percentile map
-	getPerc := func(m map[string]uint64, target string) time.Duration {
-		// FIO keys are strings like "99.000000"
-		// We try exact match or close match? FIO usually consistent.
-		if v, ok := m[target]; ok {
-			return time.Duration(v) * time.Nanosecond
+	// Helper to add a json+ bins map (nanosecond keys) to a µs histogram
+	addBins := func(hist *hdrhistogram.Histogram, bins map[string]uint64) error {
+		for k, count := range bins {
+			ns, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid fio latency bin %q: %v", k, err)
+			}
+			us := ns / 1000
+			if us < 1 { us = 1 }
+			_ = hist.RecordValues(us, int64(count))
 		}
-		// Try trim trailing zeros?
-		// For now assume standard FIO output keys
-		return 0
+		return nil
 	}
 
 	for _, j := range jobs {
@@ -158,43 +343,48 @@ func ParseOutput(jsonData []byte, duration time.Duration) (*engine.Result, error
 		
 		totalReadIOPS += j.Read.IOPS
 		totalWriteIOPS += j.Write.IOPS
+
+		totalReadBW += j.Read.BwBytes
+		totalWriteBW += j.Write.BwBytes
+		totalReadBytes += j.Read.IOBytes
+		totalWriteBytes += j.Write.IOBytes
 		
-		// This aggregation is naive if there are multiple reported groups,
-		// but with group_reporting=1 there is only one.
-		// We'll assume the latencies in the first job block are representative 
-		// (or the only ones).
-		
-		// If both read and write exist, we need to weight them.
-		rCount := float64(j.Read.TotalIOS)
-		wCount := float64(j.Write.TotalIOS)
-		total := rCount + wCount
-		
-		if total > 0 {
-			// Mean
-			rMean := j.Read.ClatNs.Mean
-			wMean := j.Write.ClatNs.Mean
-			avgMean := (rMean*rCount + wMean*wCount) / total
-			res.MeanLatency = time.Duration(avgMean) * time.Nanosecond
-
-			// P99 (Approximation)
-			rP99 := getPerc(j.Read.ClatNs.Percentile, "99.000000")
-			wP99 := getPerc(j.Write.ClatNs.Percentile, "99.000000")
-			res.P99Latency = time.Duration((float64(rP99)*rCount + float64(wP99)*wCount) / total)
-			
-			// P50
-			rP50 := getPerc(j.Read.ClatNs.Percentile, "50.000000")
-			wP50 := getPerc(j.Write.ClatNs.Percentile, "50.000000")
-			res.P50Latency = time.Duration((float64(rP50)*rCount + float64(wP50)*wCount) / total)
+		if err := addBins(readHist, j.Read.ClatNs.Bins); err != nil {
+			return nil, err
+		}
+		if err := addBins(writeHist, j.Write.ClatNs.Bins); err != nil {
+			return nil, err
+		}
+	}
+
+	if totalReadIOs > 0 && readHist.TotalCount() == 0 || totalWriteIOs > 0 && writeHist.TotalCount() == 0 {
+		return nil, fmt.Errorf("fio output has no latency bins (use --output-format=json+)")
+	}
+
+	res.Read = engine.DirStats{TotalIOs: totalReadIOs, Bytes: totalReadBytes, IOPS: totalReadIOPS, Throughput: totalReadBW}
+	res.Write = engine.DirStats{TotalIOs: totalWriteIOs, Bytes: totalWriteBytes, IOPS: totalWriteIOPS, Throughput: totalWriteBW}
+	if totalReadIOs > 0 {
+		if err := res.Read.SetLatency(readHist); err != nil {
+			return nil, err
 		}
 	}
+	if totalWriteIOs > 0 {
+		if err := res.Write.SetLatency(writeHist); err != nil {
+			return nil, err
+		}
+	}
+
+	hist := engine.NewHistogram()
+	hist.Merge(readHist)
+	hist.Merge(writeHist)
+	if err := res.SetLatency(hist); err != nil {
+		return nil, err
+	}
 	
 	res.TotalIOs = totalReadIOs + totalWriteIOs
+	res.Bytes = totalReadBytes + totalWriteBytes
 	res.IOPS = totalReadIOPS + totalWriteIOPS
-	
-	// Calculate Throughput? FIO provides it but we can derive from IOPS * BS if needed, 
-	// or parse BW field. Result struct has Throughput.
-	// Let's assume caller sets Throughput or we add BW parsing later if needed.
-	// For knee finding, IOPS is primary.
+	res.Throughput = totalReadBW + totalWriteBW
 	
 	return res, nil
 }
@@ -1,6 +1,7 @@
 package optimize
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/runningwild/jolt/pkg/config"
@@ -23,7 +24,10 @@ func (co *CoordinateOptimizer) GetHistory() []HistoryEntry {
 	return co.eval.History
 }
 
-func (co *CoordinateOptimizer) Optimize() (State, engine.Result, error) {
+// Optimize runs coordinate descent over the search variables. If ctx is
+// cancelled it stops and returns the best state found so far along with the
+// error; GetHistory has every test point that finished.
+func (co *CoordinateOptimizer) Optimize(ctx context.Context) (State, engine.Result, error) {
 	// Start with middle-of-the-road values
 	current := make(State)
 	for _, v := range co.cfg.Search {
@@ -34,7 +38,7 @@ func (co *CoordinateOptimizer) Optimize() (State, engine.Result, error) {
 		}
 	}
 
-	bestRes, bestScore, reason, err := co.eval.Evaluate(current)
+	bestRes, bestScore, reason, err := co.eval.Evaluate(ctx, current)
 	if err != nil {
 		return nil, engine.Result{}, err
 	}
@@ -55,12 +59,15 @@ func (co *CoordinateOptimizer) Optimize() (State, engine.Result, error) {
 			var localBestScore float64
 
 			if len(v.Values) > 0 {
-				localBestVal, localBestRes, localBestScore, err = co.optimizeList(current, v)
+				localBestVal, localBestRes, localBestScore, err = co.optimizeList(ctx, current, v)
 			} else {
-				localBestVal, localBestRes, localBestScore, err = co.optimizeRange(current, v)
+				localBestVal, localBestRes, localBestScore, err = co.optimizeRange(ctx, current, v)
 			}
 
 			if err != nil {
+				if ctx.Err() != nil {
+					return current, bestRes, err
+				}
 				return nil, engine.Result{}, err
 			}
 
@@ -90,7 +97,7 @@ func (co *CoordinateOptimizer) formatVal(name string, val int) string {
 	return fmt.Sprintf("%s=%d", name, val)
 }
 
-func (co *CoordinateOptimizer) optimizeList(s State, v config.Variable) (int, engine.Result, float64, error) {
+func (co *CoordinateOptimizer) optimizeList(ctx context.Context, s State, v config.Variable) (int, engine.Result, float64, error) {
 	bestVal := s[v.Name]
 	var bestRes engine.Result
 	var bestScore float64
@@ -100,7 +107,7 @@ func (co *CoordinateOptimizer) optimizeList(s State, v config.Variable) (int, en
 
 	for _, val := range v.Values {
 		tempState[v.Name] = val
-		res, score, reason, err := co.eval.Evaluate(tempState)
+		res, score, reason, err := co.eval.Evaluate(ctx, tempState)
 		if err != nil { return 0, engine.Result{}, 0, err }
 		
 		fmt.Printf("  Testing %s... Score: %.2f (%s) %s\n", co.formatVal(v.Name, val), score, co.eval.FormatMetrics(res), reason)
@@ -113,12 +120,12 @@ func (co *CoordinateOptimizer) optimizeList(s State, v config.Variable) (int, en
 	return bestVal, bestRes, bestScore, nil
 }
 
-func (co *CoordinateOptimizer) optimizeRange(s State, v config.Variable) (int, engine.Result, float64, error) {
+func (co *CoordinateOptimizer) optimizeRange(ctx context.Context, s State, v config.Variable) (int, engine.Result, float64, error) {
 	bestVal := s[v.Name]
 	tempState := make(State)
 	for k, val := range s { tempState[k] = val }
 
-	res, score, reason, err := co.eval.Evaluate(tempState)
+	res, score, reason, err := co.eval.Evaluate(ctx, tempState)
 	if err != nil { return 0, engine.Result{}, 0, err }
 	bestRes, bestScore := res, score
 	_ = reason // silence unused
@@ -132,7 +139,7 @@ func (co *CoordinateOptimizer) optimizeRange(s State, v config.Variable) (int, e
 		// Try UP
 		if bestVal + step <= v.Range[1] {
 			tempState[v.Name] = bestVal + step
-			r, s, reason, err := co.eval.Evaluate(tempState)
+			r, s, reason, err := co.eval.Evaluate(ctx, tempState)
 			if err != nil { return 0, engine.Result{}, 0, err }
 			fmt.Printf("  Testing %s... Score: %.2f (%s) %s\n", co.formatVal(v.Name, tempState[v.Name]), s, co.eval.FormatMetrics(r), reason)
 			if s > bestScore {
@@ -145,7 +152,7 @@ func (co *CoordinateOptimizer) optimizeRange(s State, v config.Variable) (int, e
 		// Try DOWN
 		if !improved && bestVal - step >= v.Range[0] {
 			tempState[v.Name] = bestVal - step
-			r, s, reason, err := co.eval.Evaluate(tempState)
+			r, s, reason, err := co.eval.Evaluate(ctx, tempState)
 			if err != nil { return 0, engine.Result{}, 0, err }
 			fmt.Printf("  Testing %s... Score: %.2f (%s) %s\n", co.formatVal(v.Name, tempState[v.Name]), s, co.eval.FormatMetrics(r), reason)
 			if s > bestScore {
@@ -0,0 +1,44 @@
+package optimize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runningwild/jolt/pkg/config"
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+func TestCoordinateSim(t *testing.T) {
+	cfg := &config.Config{
+		Settings: config.Settings{
+			EngineType: "sim",
+			ReadPct:    100,
+			Rand:       true,
+			MinRuntime: time.Second,
+			MaxRuntime: time.Second,
+		},
+		Search: []config.Variable{
+			{Name: "queue_depth", Range: []int{1, 64}, Step: 4},
+			{Name: "workers", Values: []int{1, 2, 4, 8}},
+			{Name: "block_size", Values: []int{4096}},
+		},
+		Objectives: []config.Objective{
+			{Type: "maximize", Metric: "iops"},
+			{Type: "constraint", Metric: "p99_latency", Limit: "400us"},
+		},
+	}
+
+	best, res, err := NewCoordinate(engine.NewSim(), cfg).Optimize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("best %v: IOPS=%.0f P99=%v", best, res.IOPS, res.P99Latency)
+	if res.P99Latency > 400*time.Microsecond {
+		t.Errorf("best state %v violates the latency constraint: %v", best, res.P99Latency)
+	}
+	// The device tops out around 320k IOPS; the constraint allows most of it.
+	if res.IOPS < 250000 {
+		t.Errorf("best state %v only reaches %.0f IOPS", best, res.IOPS)
+	}
+}
@@ -1,9 +1,11 @@
 package optimize
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/runningwild/jolt/pkg/config"
@@ -41,60 +43,98 @@ func (e *Evaluator) NumNodes() int {
 	return e.eng.NumNodes()
 }
 
-func (e *Evaluator) Evaluate(s State) (engine.Result, float64, string, error) {
+func (e *Evaluator) Evaluate(ctx context.Context, s State) (engine.Result, float64, string, error) {
 	p := engine.Params{
 		EngineType:  e.cfg.Settings.EngineType,
 		Path:        e.cfg.Target,
 		Direct:      e.cfg.Settings.Direct,
 		ReadPct:     e.cfg.Settings.ReadPct,
+		DiscardPct:  e.cfg.Settings.DiscardPct,
+		WriteZeroesPct: e.cfg.Settings.WriteZeroesPct,
 		Rand:        e.cfg.Settings.Rand,
+		Distribution: e.cfg.Settings.Distribution,
+		BSSplit:     e.cfg.Settings.BSSplit,
+		Offset:      e.cfg.Settings.Offset,
+		Length:      e.cfg.Settings.Length,
+		WorkingSet:  e.cfg.Settings.WorkingSet,
+		Disjoint:    e.cfg.Settings.Disjoint,
+		TargetIOPS:  e.cfg.Settings.TargetIOPS,
+		Arrival:     e.cfg.Settings.Arrival,
+		SpinWait:    e.cfg.Settings.SpinWait,
+		ThinkTime:   e.cfg.Settings.ThinkTime,
+		ThinkDist:   e.cfg.Settings.ThinkDist,
+		BurstIOs:    e.cfg.Settings.BurstIOs,
+		BurstIdle:   e.cfg.Settings.BurstIdle,
+		Verify:      e.cfg.Settings.Verify,
+		TraceFile:   e.cfg.Settings.Trace,
+		ReplaySpeed: e.cfg.Settings.ReplaySpeed,
+		FixedBufs:   e.cfg.Settings.FixedBufs,
+		FixedFiles:  e.cfg.Settings.FixedFiles,
+		SQPoll:      e.cfg.Settings.SQPoll,
+		SQPollIdle:  e.cfg.Settings.SQPollIdle,
+		IOPoll:      e.cfg.Settings.IOPoll,
+		SubmitBatch: e.cfg.Settings.SubmitBatch,
+		CompleteBatch: e.cfg.Settings.CompleteBatch,
+		Sim:         e.cfg.Settings.Sim,
+		CPUs:        e.cfg.Settings.CPUs,
+		SyncMode:    e.cfg.Settings.SyncMode,
+		FsyncEvery:  e.cfg.Settings.FsyncEvery,
+		Fdatasync:   e.cfg.Settings.Fdatasync,
+		CompressRatio: e.cfg.Settings.CompressRatio,
+		DedupePct:   e.cfg.Settings.DedupePct,
+		RefillEvery: e.cfg.Settings.RefillEvery,
+		RampTime:    e.cfg.Settings.RampTime,
 		MinRuntime:  e.cfg.Settings.MinRuntime,
 		MaxRuntime:  e.cfg.Settings.MaxRuntime,
 		ErrorTarget: e.cfg.Settings.ErrorTarget,
+		StopRule:    e.cfg.Settings.StopRule,
+		StopIOs:     e.cfg.Settings.StopIOs,
+		SeriesInterval: e.cfg.Settings.SeriesInterval,
+		Groups:      e.cfg.Settings.Groups,
 		BlockSize:   4096,
 		Workers:     1,
 		QueueDepth:  1,
 	}
 
+	for _, obj := range e.cfg.Objectives {
+		name, m, grouped := strings.Cut(obj.Metric, ".")
+		if grouped && !hasGroup(p.Groups, name) {
+			return engine.Result{}, 0, "", fmt.Errorf("objective %s: no group %q", obj.Metric, name)
+		}
+		// CPU use is only measured for the whole run, and isn't a latency.
+		if _, ok := cpuMetric(engine.Result{}, m); ok && grouped {
+			return engine.Result{}, 0, "", fmt.Errorf("objective %s: CPU metrics are not available per group", obj.Metric)
+		}
+		if _, ok := cpuMetric(engine.Result{}, obj.Metric); ok && obj.Type == "constraint" {
+			return engine.Result{}, 0, "", fmt.Errorf("objective %s: CPU metrics cannot be constraints", obj.Metric)
+		}
+	}
+
 	key := e.hashState(s)
 
 	if v, ok := s["block_size"]; ok { p.BlockSize = v }
 	if v, ok := s["workers"]; ok { p.Workers = v }
 	if v, ok := s["queue_depth"]; ok { p.QueueDepth = v }
+	if v, ok := s["target_iops"]; ok { p.TargetIOPS = float64(v) }
+	if v, ok := s["discard_pct"]; ok { p.DiscardPct = v }
+	if v, ok := s["fixed_bufs"]; ok { p.FixedBufs = v != 0 }
+	if v, ok := s["fixed_files"]; ok { p.FixedFiles = v != 0 }
+	if v, ok := s["sqpoll"]; ok { p.SQPoll = v != 0 }
+	if v, ok := s["sqpoll_idle"]; ok { p.SQPollIdle = time.Duration(v) * time.Millisecond }
+	if v, ok := s["iopoll"]; ok { p.IOPoll = v != 0 }
+	if v, ok := s["submit_batch"]; ok { p.SubmitBatch = v }
+	if v, ok := s["complete_batch"]; ok { p.CompleteBatch = v }
 
-	res, err := e.eng.Run(p)
+	res, err := e.eng.Run(ctx, p)
 	if err != nil {
 		return engine.Result{}, 0, "", err
 	}
 
 	// Aggregate with cached result
 	if cached, found := e.Cache[key]; found {
-		// Merge logic
-		totalDuration := cached.Duration + res.Duration
-		totalIOs := cached.TotalIOs + res.TotalIOs
-		
-		// Weighted average for latencies
-		// NOTE: Averaging percentiles is a statistical approximation and not mathematically correct.
-		// A true merge would require the raw histograms or full latency lists from both results.
-		// For the purpose of this heuristic optimizer, we accept this error to save memory/complexity,
-		// but be aware that merged P99 values may be slightly off compared to a fresh run of the same duration.
-		wOld := float64(cached.TotalIOs)
-		wNew := float64(res.TotalIOs)
-		totalW := wOld + wNew
-		
-		mergedP50 := time.Duration((float64(cached.P50Latency)*wOld + float64(res.P50Latency)*wNew) / totalW)
-		mergedP99 := time.Duration((float64(cached.P99Latency)*wOld + float64(res.P99Latency)*wNew) / totalW)
-		
-		// Recalculate metrics
-		mergedRes := engine.Result{
-			TotalIOs:         totalIOs,
-			Duration:         totalDuration,
-			IOPS:             float64(totalIOs) / totalDuration.Seconds(),
-			Throughput:       float64(totalIOs*int64(p.BlockSize)) / totalDuration.Seconds(),
-			P50Latency:       mergedP50,
-			P99Latency:       mergedP99,
-			MetricConfidence: (cached.MetricConfidence + res.MetricConfidence) / 2, // Approximate
-			TerminationReason: res.TerminationReason, // Keep latest reason
+		mergedRes, err := mergeRuns(&cached, res)
+		if err != nil {
+			return engine.Result{}, 0, "", err
 		}
 		*res = mergedRes
 	}
@@ -124,14 +164,114 @@ func (e *Evaluator) Evaluate(s State) (engine.Result, float64, string, error) {
 	return *res, score, reason, nil
 }
 
+// hasGroup reports whether groups has one called name.
+func hasGroup(groups []engine.Group, name string) bool {
+	for _, g := range groups {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRuns combines the results of two sequential runs of the same state,
+// and those of each of their groups.
+func mergeRuns(cached, res *engine.Result) (engine.Result, error) {
+	totalDuration := cached.Duration + res.Duration
+	totalIOs := cached.TotalIOs + res.TotalIOs
+	totalBytes := cached.Bytes + res.Bytes
+	
+	// Recalculate metrics
+	mergedRes := engine.Result{
+		TotalIOs:         totalIOs,
+		Bytes:            totalBytes,
+		Duration:         totalDuration,
+		IOPS:             float64(totalIOs) / totalDuration.Seconds(),
+		Throughput:       float64(totalBytes) / totalDuration.Seconds(),
+		MetricConfidence: (cached.MetricConfidence + res.MetricConfidence) / 2, // Approximate
+		TerminationReason: res.TerminationReason, // Keep latest reason
+		Placement:        res.Placement,         // Same CPUs for the same state
+	}
+
+	mergedRes.Read = mergeDirStats(cached.Read, res.Read, totalDuration)
+	mergedRes.Write = mergeDirStats(cached.Write, res.Write, totalDuration)
+	mergedRes.Flush = mergeDirStats(cached.Flush, res.Flush, totalDuration)
+	mergedRes.Discard = mergeDirStats(cached.Discard, res.Discard, totalDuration)
+	mergedRes.WriteZeroes = mergeDirStats(cached.WriteZeroes, res.WriteZeroes, totalDuration)
+	mergedRes.Slat.TotalIOs = cached.Slat.TotalIOs + res.Slat.TotalIOs
+	mergedRes.Clat.TotalIOs = cached.Clat.TotalIOs + res.Clat.TotalIOs
+	mergedRes.CPU = mergeCPU(cached.CPU, res.CPU, totalIOs)
+	// Like IOPS, the offered rate is recomputed from the I/Os offered.
+	offered := cached.OfferedIOPS*cached.Duration.Seconds() + res.OfferedIOPS*res.Duration.Seconds()
+	mergedRes.OfferedIOPS = offered / totalDuration.Seconds()
+	// The repeat's series carries on where the cached one ended.
+	mergedRes.Series = append([]engine.SeriesPoint(nil), cached.Series...)
+	for _, p := range res.Series {
+		p.Time += cached.Duration
+		mergedRes.Series = append(mergedRes.Series, p)
+	}
+
+	// Latency percentiles cannot be averaged, so recompute them from the
+	// combined histograms of both runs.
+	if err := engine.MergeLatency(&mergedRes, cached, res); err != nil {
+		return engine.Result{}, err
+	}
+	engine.MergeVerify(&mergedRes, cached, res)
+	engine.MergeDevice(&mergedRes, cached, res)
+	engine.MergeNodeDevices(&mergedRes, cached, res)
+
+	for name, g := range res.Groups {
+		if c := cached.Groups[name]; c != nil {
+			merged, err := mergeRuns(c, g)
+			if err != nil {
+				return engine.Result{}, err
+			}
+			g = &merged
+		}
+		if mergedRes.Groups == nil {
+			mergedRes.Groups = make(map[string]*engine.Result)
+		}
+		mergedRes.Groups[name] = g
+	}
+	return mergedRes, nil
+}
+
+// mergeDirStats combines the counters of two sequential runs of the same
+// state. Latencies are filled in separately by engine.MergeLatency.
+func mergeDirStats(a, b engine.DirStats, totalDuration time.Duration) engine.DirStats {
+	totalIOs := a.TotalIOs + b.TotalIOs
+	totalBytes := a.Bytes + b.Bytes
+	return engine.DirStats{
+		TotalIOs:   totalIOs,
+		Bytes:      totalBytes,
+		IOPS:       float64(totalIOs) / totalDuration.Seconds(),
+		Throughput: float64(totalBytes) / totalDuration.Seconds(),
+	}
+}
+
+// mergeCPU combines the CPU use of two sequential runs of the same state.
+func mergeCPU(a, b engine.CPUStats, totalIOs int64) engine.CPUStats {
+	wall := a.Wall + b.Wall
+	if wall <= 0 {
+		return engine.CPUStats{}
+	}
+	systemPct := (a.SystemPct*a.Wall.Seconds() + b.SystemPct*b.Wall.Seconds()) / wall.Seconds()
+	return engine.NewCPUStats(a.User+b.User, a.Sys+b.Sys, wall, systemPct, totalIOs)
+}
+
 func (e *Evaluator) hashState(s State) string {
 	// deterministic key
 	// Map iteration is random, so we must sort keys or hardcode known keys
-	// We only have 3 known keys
 	// NOTE: This explicitly ignores any other keys in the State map.
 	// If new tunable parameters are added to State, they MUST be added here
 	// or they will be ignored for caching purposes.
-	return fmt.Sprintf("bs=%d:qd=%d:w=%d", s["block_size"], s["queue_depth"], s["workers"])
+	key := fmt.Sprintf("bs=%d:qd=%d:w=%d:rate=%d", s["block_size"], s["queue_depth"], s["workers"], s["target_iops"])
+	for _, k := range []string{"discard_pct", "fixed_bufs", "fixed_files", "sqpoll", "sqpoll_idle", "iopoll", "submit_batch", "complete_batch"} {
+		if v, ok := s[k]; ok {
+			key += fmt.Sprintf(":%s=%d", k, v)
+		}
+	}
+	return key
 }
 
 func (e *Evaluator) scaleScore(raw float64, reason string) float64 {
@@ -142,23 +282,14 @@ func (e *Evaluator) scaleScore(raw float64, reason string) float64 {
 }
 
 func (e *Evaluator) calculateScore(res engine.Result) (float64, string) {
+	if res.VerifyFailures > 0 {
+		return 0, fmt.Sprintf("Verify Failed: %d bad blocks (first at offset %d: %s)", res.VerifyFailures, res.VerifyErrors[0].Offset, res.VerifyErrors[0].Reason)
+	}
 	for _, obj := range e.cfg.Objectives {
 		if obj.Type == "constraint" {
 			limitVal := parseLimit(obj.Limit)
-			var actualDur time.Duration
-			passed := true
-			switch obj.Metric {
-			case "p99_latency":
-				actualDur = res.P99Latency
-				if res.P99Latency > limitVal { passed = false }
-			case "p50_latency":
-				actualDur = res.P50Latency
-				if res.P50Latency > limitVal { passed = false }
-			case "p95_latency":
-				actualDur = res.P95Latency
-				if res.P95Latency > limitVal { passed = false }
-			}
-			if !passed {
+			actualDur, ok := latencyMetric(res, obj.Metric)
+			if ok && actualDur > limitVal {
 				return 0, fmt.Sprintf("Constraint Failed: %s (%v > %s)", obj.Metric, actualDur, obj.Limit)
 			}
 		}
@@ -167,25 +298,102 @@ func (e *Evaluator) calculateScore(res engine.Result) (float64, string) {
 	score := 0.0
 	for _, obj := range e.cfg.Objectives {
 		val := 0.0
-		switch obj.Metric {
-		case "iops": val = res.IOPS
-		case "throughput": val = res.Throughput / 1024 / 1024
-		case "p99_latency": val = -float64(res.P99Latency.Seconds() * 1000)
-		case "p50_latency": val = -float64(res.P50Latency.Seconds() * 1000)
+		if d, ok := latencyMetric(res, obj.Metric); ok {
+			val = -float64(d.Seconds() * 1000)
+		} else if v, ok := cpuMetric(res, obj.Metric); ok {
+			val = v
+		} else {
+			stats, base, _ := dirStats(res, obj.Metric)
+			switch base {
+			case "iops": val = stats.IOPS
+			case "throughput": val = stats.Throughput / 1024 / 1024
+			}
 		}
 		if obj.Type == "maximize" { score += val } else if obj.Type == "minimize" { score -= val }
 	}
 	return score, ""
 }
 
+// dirStats returns the statistics an objective metric refers to. The "read_"
+// and "write_" prefixes select a single direction; "flush_", "discard_" and
+// "write_zeroes_" those operations; "slat_" and "clat_" the submission and
+// completion latency, and anything else the totals. A "<group>." prefix
+// selects one group of a run with groups first.
+// It also returns the metric without its prefixes and a display label prefix.
+func dirStats(res engine.Result, metric string) (engine.DirStats, string, string) {
+	if name, m, ok := strings.Cut(metric, "."); ok {
+		var g engine.Result
+		if r := res.Groups[name]; r != nil {
+			g = *r
+		}
+		stats, base, label := dirStats(g, m)
+		return stats, base, name + " " + label
+	}
+	switch {
+	case strings.HasPrefix(metric, "read_"):
+		return res.Read, strings.TrimPrefix(metric, "read_"), "Read "
+	case strings.HasPrefix(metric, "write_zeroes_"):
+		return res.WriteZeroes, strings.TrimPrefix(metric, "write_zeroes_"), "Write-zeroes "
+	case strings.HasPrefix(metric, "write_"):
+		return res.Write, strings.TrimPrefix(metric, "write_"), "Write "
+	case strings.HasPrefix(metric, "flush_"):
+		return res.Flush, strings.TrimPrefix(metric, "flush_"), "Flush "
+	case strings.HasPrefix(metric, "discard_"):
+		return res.Discard, strings.TrimPrefix(metric, "discard_"), "Discard "
+	case strings.HasPrefix(metric, "slat_"):
+		return res.Slat, strings.TrimPrefix(metric, "slat_"), "Submit "
+	case strings.HasPrefix(metric, "clat_"):
+		return res.Clat, strings.TrimPrefix(metric, "clat_"), "Completion "
+	}
+	return engine.DirStats{
+		IOPS:        res.IOPS,
+		Throughput:  res.Throughput,
+		MeanLatency: res.MeanLatency,
+		P50Latency:  res.P50Latency,
+		P95Latency:  res.P95Latency,
+		P99Latency:  res.P99Latency,
+		P999Latency: res.P999Latency,
+		TotalIOs:    res.TotalIOs,
+	}, metric, ""
+}
+
+// latencyMetric resolves latency metrics such as "p99_latency" or
+// "write_p99_latency". ok is false if metric is not a latency metric.
+func latencyMetric(res engine.Result, metric string) (d time.Duration, ok bool) {
+	stats, base, _ := dirStats(res, metric)
+	switch base {
+	case "p50_latency": return stats.P50Latency, true
+	case "p95_latency": return stats.P95Latency, true
+	case "p99_latency": return stats.P99Latency, true
+	case "p999_latency": return stats.P999Latency, true
+	}
+	return 0, false
+}
+
+// cpuMetric resolves the CPU efficiency metrics: "cpu_per_io", µs of CPU per
+// I/O (lower is better), and "iops_per_core" (higher is better). ok is false
+// for any other metric.
+func cpuMetric(res engine.Result, metric string) (v float64, ok bool) {
+	switch metric {
+	case "cpu_per_io": return res.CPU.PerIO, true
+	case "iops_per_core": return res.CPU.IOPSPerCore, true
+	}
+	return 0, false
+}
+
 func (e *Evaluator) FormatMetrics(res engine.Result) string {
 	var parts []string
 	for _, obj := range e.cfg.Objectives {
-		switch obj.Metric {
-		case "iops": parts = append(parts, fmt.Sprintf("IOPS: %.0f", res.IOPS))
-		case "throughput": parts = append(parts, fmt.Sprintf("BW: %.2f MB/s", res.Throughput/1024/1024))
-		case "p99_latency": parts = append(parts, fmt.Sprintf("P99: %v", res.P99Latency))
-		case "p50_latency": parts = append(parts, fmt.Sprintf("P50: %v", res.P50Latency))
+		stats, base, label := dirStats(res, obj.Metric)
+		switch base {
+		case "cpu_per_io": parts = append(parts, fmt.Sprintf("CPU/IO: %.1fµs (%.0f%% CPU)", res.CPU.PerIO, res.CPU.Pct))
+		case "iops_per_core": parts = append(parts, fmt.Sprintf("IOPS/core: %.0f (%.0f%% CPU)", res.CPU.IOPSPerCore, res.CPU.Pct))
+		case "iops": parts = append(parts, fmt.Sprintf("%sIOPS: %.0f", label, stats.IOPS))
+		case "throughput": parts = append(parts, fmt.Sprintf("%sBW: %.2f MB/s", label, stats.Throughput/1024/1024))
+		case "p50_latency": parts = append(parts, fmt.Sprintf("%sP50: %v", label, stats.P50Latency))
+		case "p95_latency": parts = append(parts, fmt.Sprintf("%sP95: %v", label, stats.P95Latency))
+		case "p99_latency": parts = append(parts, fmt.Sprintf("%sP99: %v", label, stats.P99Latency))
+		case "p999_latency": parts = append(parts, fmt.Sprintf("%sP99.9: %v", label, stats.P999Latency))
 		}
 	}
 	if len(parts) == 0 { return fmt.Sprintf("IOPS: %.0f", res.IOPS) }
@@ -1,6 +1,7 @@
 package optimize
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -12,7 +13,7 @@ type mockEngine struct {
 	runFunc func(params engine.Params) (*engine.Result, error)
 }
 
-func (m *mockEngine) Run(params engine.Params) (*engine.Result, error) {
+func (m *mockEngine) Run(ctx context.Context, params engine.Params) (*engine.Result, error) {
 	return m.runFunc(params)
 }
 
@@ -41,7 +42,7 @@ func TestEvaluator_Scoring(t *testing.T) {
 	eval := NewEvaluator(mock, cfg)
 	state := State{"workers": 1}
 
-	_, score, reason, err := eval.Evaluate(state)
+	_, score, reason, err := eval.Evaluate(context.Background(), state)
 	if err != nil {
 		t.Fatalf("Evaluate failed: %v", err)
 	}
@@ -75,7 +76,7 @@ func TestEvaluator_ConstraintFailure(t *testing.T) {
 	eval := NewEvaluator(mock, cfg)
 	state := State{"workers": 2}
 
-	_, score, reason, err := eval.Evaluate(state)
+	_, score, reason, err := eval.Evaluate(context.Background(), state)
 	if err != nil {
 		t.Fatalf("Evaluate failed: %v", err)
 	}
@@ -108,7 +109,7 @@ func TestEvaluator_Caching(t *testing.T) {
 	state := State{"workers": 1}
 
 	// First call
-	eval.Evaluate(state)
+	eval.Evaluate(context.Background(), state)
 	if callCount != 1 {
 		t.Errorf("Expected 1 call, got %d", callCount)
 	}
@@ -122,7 +123,7 @@ func TestEvaluator_Caching(t *testing.T) {
 	// So callCount WILL increase.
 	// But the result in Cache should have doubled TotalIOs.
 	
-	eval.Evaluate(state)
+	eval.Evaluate(context.Background(), state)
 	if callCount != 2 {
 		t.Errorf("Expected 2 calls, got %d", callCount)
 	}
@@ -133,3 +134,262 @@ func TestEvaluator_Caching(t *testing.T) {
 		t.Errorf("Expected aggregated TotalIOs=200, got %d", cached.TotalIOs)
 	}
 }
+
+func TestEvaluator_CacheMergesOfferedIOPS(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{{Type: "maximize", Metric: "iops"}},
+	}
+
+	// 1200 offered over 1s, then 3000 over 2s: 4200 over 3s.
+	runs := []engine.Result{
+		{IOPS: 1000, OfferedIOPS: 1200, TotalIOs: 1000, Duration: time.Second},
+		{IOPS: 1000, OfferedIOPS: 1500, TotalIOs: 2000, Duration: 2 * time.Second},
+	}
+	call := 0
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			res := runs[call]
+			call++
+			return &res, nil
+		},
+	}
+
+	eval := NewEvaluator(mock, cfg)
+	state := State{"workers": 1}
+	eval.Evaluate(context.Background(), state)
+	res, _, _, err := eval.Evaluate(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if res.OfferedIOPS != 1400 {
+		t.Errorf("Expected merged OfferedIOPS=1400, got %v", res.OfferedIOPS)
+	}
+}
+
+func TestEvaluator_CacheKeepsPlacement(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{{Type: "maximize", Metric: "iops"}},
+	}
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			return &engine.Result{
+				IOPS:      1000,
+				TotalIOs:  1000,
+				Duration:  time.Second,
+				Placement: &engine.Placement{CPUs: "0-1", Node: -1},
+			}, nil
+		},
+	}
+
+	eval := NewEvaluator(mock, cfg)
+	state := State{"workers": 1}
+	eval.Evaluate(context.Background(), state)
+	res, _, _, err := eval.Evaluate(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if res.Placement == nil || res.Placement.CPUs != "0-1" {
+		t.Errorf("Expected placement to be kept, got %+v", res.Placement)
+	}
+}
+
+func TestEvaluator_CacheMergesHistograms(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{{Type: "maximize", Metric: "iops"}},
+	}
+
+	// First run is uniformly fast, second is uniformly slow. Averaging the
+	// per-run P99s would give ~5ms; the merged distribution's P99 is 10ms.
+	latencies := []int64{100, 10000}
+	call := 0
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			hist := engine.NewHistogram()
+			_ = hist.RecordValues(latencies[call], 1000)
+			call++
+			res := &engine.Result{
+				IOPS:     1000,
+				TotalIOs: 1000,
+				Duration: 1 * time.Second,
+			}
+			if err := res.SetLatency(hist); err != nil {
+				return nil, err
+			}
+			return res, nil
+		},
+	}
+
+	eval := NewEvaluator(mock, cfg)
+	state := State{"workers": 1}
+	eval.Evaluate(context.Background(), state)
+	res, _, _, err := eval.Evaluate(context.Background(), state)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+
+	if res.P50Latency > 101*time.Microsecond {
+		t.Errorf("Expected merged P50 ~100µs, got %v", res.P50Latency)
+	}
+	if res.P99Latency < 9900*time.Microsecond || res.P99Latency > 10100*time.Microsecond {
+		t.Errorf("Expected merged P99 ~10ms, got %v", res.P99Latency)
+	}
+}
+
+func TestEvaluator_DirectionalConstraint(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{
+			{Type: "maximize", Metric: "iops"},
+			{Type: "constraint", Metric: "write_p99_latency", Limit: "10ms"},
+		},
+	}
+
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			return &engine.Result{
+				IOPS:       2000,
+				P99Latency: 5 * time.Millisecond, // Overall is fine...
+				Write:      engine.DirStats{P99Latency: 20 * time.Millisecond}, // ...writes are not
+				TotalIOs:   1000,
+				Duration:   1 * time.Second,
+			}, nil
+		},
+	}
+
+	eval := NewEvaluator(mock, cfg)
+	_, _, reason, err := eval.Evaluate(context.Background(), State{"workers": 1})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if reason == "" {
+		t.Error("Expected write_p99_latency constraint to fail")
+	}
+}
+
+func TestEvaluator_CPUObjective(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{
+			{Type: "minimize", Metric: "cpu_per_io"},
+		},
+	}
+	// More workers are faster but burn more CPU per I/O.
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			ios := int64(1000 * params.Workers)
+			cpu := time.Duration(params.Workers*params.Workers) * 10 * time.Millisecond
+			return &engine.Result{
+				IOPS:     float64(ios),
+				TotalIOs: ios,
+				Duration: time.Second,
+				CPU:      engine.NewCPUStats(cpu, 0, time.Second, 0, ios),
+			}, nil
+		},
+	}
+	eval := NewEvaluator(mock, cfg)
+
+	res1, score1, _, err := eval.Evaluate(context.Background(), State{"workers": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, score4, _, err := eval.Evaluate(context.Background(), State{"workers": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res1.CPU.PerIO != 10 {
+		t.Errorf("cpu_per_io = %gµs, want 10", res1.CPU.PerIO)
+	}
+	if score1 <= score4 {
+		t.Errorf("1 worker (%gµs/IO) scored %f, not above 4 workers (%f)", res1.CPU.PerIO, score1, score4)
+	}
+
+	// A repeat of a state merges the CPU of both runs.
+	merged, _, _, err := eval.Evaluate(context.Background(), State{"workers": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CPU.Wall != 2*time.Second || merged.CPU.PerIO != 10 || merged.CPU.IOPSPerCore != 1e5 {
+		t.Errorf("merged CPU %+v", merged.CPU)
+	}
+}
+
+func TestEvaluator_CPUObjectiveRejected(t *testing.T) {
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			t.Errorf("engine ran")
+			return &engine.Result{}, nil
+		},
+	}
+	for _, obj := range []config.Objective{
+		{Type: "minimize", Metric: "probe.cpu_per_io"},
+		{Type: "maximize", Metric: "probe.iops_per_core"},
+		{Type: "constraint", Metric: "cpu_per_io", Limit: "10"},
+	} {
+		cfg := &config.Config{
+			Settings:   config.Settings{Groups: []engine.Group{{Name: "probe"}}},
+			Objectives: []config.Objective{obj},
+		}
+		if _, _, _, err := NewEvaluator(mock, cfg).Evaluate(context.Background(), State{}); err == nil {
+			t.Errorf("%s %s accepted", obj.Type, obj.Metric)
+		}
+	}
+}
+
+func TestEvaluator_GroupObjective(t *testing.T) {
+	cfg := &config.Config{
+		Objectives: []config.Objective{
+			{Type: "maximize", Metric: "writer.throughput"},
+			{Type: "constraint", Metric: "probe.p99_latency", Limit: "1ms"},
+		},
+		Settings: config.Settings{
+			Groups: []engine.Group{{Name: "probe"}, {Name: "writer", Background: true}},
+		},
+	}
+	// The deeper the writer's queue, the more it slows the probe down.
+	mock := &mockEngine{
+		runFunc: func(params engine.Params) (*engine.Result, error) {
+			if len(params.Groups) != 2 {
+				t.Fatalf("groups not passed on: %+v", params.Groups)
+			}
+			hist := engine.NewHistogram()
+			_ = hist.RecordValues(int64(200*params.QueueDepth), 1000)
+			probe := &engine.Result{TotalIOs: 1000, Duration: time.Second}
+			if err := probe.SetLatency(hist); err != nil {
+				return nil, err
+			}
+			writer := &engine.Result{TotalIOs: 100, Bytes: int64(params.QueueDepth) << 20, Duration: time.Second}
+			writer.Throughput = float64(writer.Bytes)
+			return &engine.Result{
+				TotalIOs: 1100,
+				Duration: time.Second,
+				Groups:   map[string]*engine.Result{"probe": probe, "writer": writer},
+			}, nil
+		},
+	}
+	eval := NewEvaluator(mock, cfg)
+
+	_, score2, reason, err := eval.Evaluate(context.Background(), State{"queue_depth": 2})
+	if err != nil || reason != "" {
+		t.Fatalf("QD 2: %v, %q", err, reason)
+	}
+	if _, _, reason, _ = eval.Evaluate(context.Background(), State{"queue_depth": 8}); reason == "" {
+		t.Errorf("probe P99 constraint passed at QD 8")
+	}
+	res, score, _, err := eval.Evaluate(context.Background(), State{"queue_depth": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repeat merges each group.
+	if p := res.Groups["probe"]; p == nil || p.TotalIOs != 2000 || p.P99Latency < 390*time.Microsecond || p.P99Latency > 410*time.Microsecond {
+		t.Errorf("merged probe %+v", p)
+	}
+	if score != score2 {
+		t.Errorf("repeat scored %f, first run %f", score, score2)
+	}
+	if got := eval.FormatMetrics(res); got != "writer BW: 2.00 MB/s, probe P99: 400µs" {
+		t.Errorf("FormatMetrics = %q", got)
+	}
+
+	cfg.Objectives = append(cfg.Objectives, config.Objective{Type: "maximize", Metric: "reader.iops"})
+	if _, _, _, err := eval.Evaluate(context.Background(), State{"queue_depth": 2}); err == nil {
+		t.Errorf("objective on an unknown group accepted")
+	}
+}
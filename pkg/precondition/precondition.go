@@ -0,0 +1,204 @@
+package precondition
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/runningwild/jolt/pkg/analyze"
+	"github.com/runningwild/jolt/pkg/config"
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+// Round is one random-write round of preconditioning.
+type Round struct {
+	Round      int
+	IOPS       float64
+	P99Latency time.Duration
+	Duration   time.Duration
+}
+
+// Report summarizes a preconditioning run.
+type Report struct {
+	FillBytes    int64
+	FillDuration time.Duration
+	Rounds       []Round
+	SteadyState  bool
+	Window       analyze.SteadyStateResult // Criteria for the last Window rounds
+}
+
+type Preconditioner struct {
+	eng    engine.Engine
+	target string
+	s      config.Settings
+	p      config.Precondition
+}
+
+// New returns a Preconditioner for the target and I/O region of cfg, using
+// p with defaults filled in.
+func New(eng engine.Engine, cfg *config.Config, p config.Precondition) *Preconditioner {
+	if p.FillBlockSize <= 0 {
+		p.FillBlockSize = 128 * 1024
+	}
+	if p.BlockSize <= 0 {
+		p.BlockSize = 4096
+	}
+	if p.Workers <= 0 {
+		p.Workers = 4
+	}
+	if p.QueueDepth <= 0 {
+		p.QueueDepth = 32
+	}
+	if p.RoundTime <= 0 {
+		p.RoundTime = time.Minute
+	}
+	if p.Window <= 0 {
+		p.Window = 5
+	}
+	if p.MaxRounds <= 0 {
+		p.MaxRounds = 25
+	}
+	return &Preconditioner{eng: eng, target: cfg.Target, s: cfg.Settings, p: p}
+}
+
+// Run fills the region and then runs random-write rounds until steady state
+// or MaxRounds. Not reaching steady state is reported, not an error. If ctx
+// is cancelled, Run stops and returns the rounds so far along with the error.
+func (pc *Preconditioner) Run(ctx context.Context) (*Report, error) {
+	rep := &Report{}
+
+	if !pc.p.SkipFill {
+		fmt.Printf("Preconditioning: sequential fill of %s...\n", pc.target)
+		start := time.Now()
+		n, err := pc.fill(ctx)
+		if err != nil {
+			return rep, fmt.Errorf("fill failed: %w", err)
+		}
+		rep.FillBytes = n
+		rep.FillDuration = time.Since(start)
+		fmt.Printf("Filled %d MiB in %v (%.0f MB/s)\n", n>>20, rep.FillDuration.Round(time.Second), float64(n)/rep.FillDuration.Seconds()/1e6)
+	}
+
+	params := engine.Params{
+		EngineType: pc.s.EngineType,
+		Path:       pc.target,
+		BlockSize:  pc.p.BlockSize,
+		Direct:     pc.s.Direct,
+		ReadPct:    0,
+		Rand:       true,
+		Offset:     pc.s.Offset,
+		Length:     pc.s.Length,
+		Workers:    pc.p.Workers,
+		QueueDepth: pc.p.QueueDepth,
+		MinRuntime: pc.p.RoundTime,
+		MaxRuntime: pc.p.RoundTime,
+	}
+
+	var iops []float64
+	for i := 1; i <= pc.p.MaxRounds; i++ {
+		res, err := pc.eng.Run(ctx, params)
+		if err != nil {
+			return rep, fmt.Errorf("round %d failed: %w", i, err)
+		}
+		rep.Rounds = append(rep.Rounds, Round{Round: i, IOPS: res.IOPS, P99Latency: res.P99Latency, Duration: res.Duration})
+		iops = append(iops, res.IOPS)
+
+		rep.Window = analyze.SteadyState(iops, pc.p.Window)
+		fmt.Printf("Round %d: IOPS=%.0f P99=%v", i, res.IOPS, res.P99Latency)
+		if rep.Window.Start >= 0 {
+			fmt.Printf(" (window range %.1f%%, slope %.1f%%)", rep.Window.Range*100, rep.Window.Slope*100)
+		}
+		fmt.Println()
+
+		if rep.Window.Steady {
+			rep.SteadyState = true
+			fmt.Printf("Steady state reached after %d rounds (average %.0f IOPS)\n", i, rep.Window.Average)
+			return rep, nil
+		}
+	}
+	fmt.Printf("Warning: steady state not reached after %d rounds\n", pc.p.MaxRounds)
+	return rep, nil
+}
+
+// fill writes the whole I/O region once, sequentially, with one writer per
+// worker each covering a contiguous slice.
+func (pc *Preconditioner) fill(ctx context.Context) (int64, error) {
+	flags := os.O_WRONLY
+	if pc.s.Direct {
+		flags |= engine.O_DIRECT
+	}
+	f, err := os.OpenFile(pc.target, flags, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	start := pc.s.Offset
+	end := size
+	if pc.s.Length > 0 && start+pc.s.Length < end {
+		end = start + pc.s.Length
+	}
+	bs := int64(pc.p.FillBlockSize)
+	if start < 0 || start >= end {
+		return 0, fmt.Errorf("empty fill region [%d, %d)", start, end)
+	}
+
+	// Incompressible data, so compressing drives don't get off lightly.
+	buf, err := unix.Mmap(-1, 0, int(bs), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate aligned memory: %v", err)
+	}
+	defer unix.Munmap(buf)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
+
+	blocks := (end - start) / bs
+	workers := int64(pc.p.Workers)
+	per := (blocks + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := int64(0); w < workers; w++ {
+		wg.Add(1)
+		go func(first, last int64) {
+			defer wg.Done()
+			for b := first; b < last; b++ {
+				if err := ctx.Err(); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := f.WriteAt(buf, start+b*bs); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w*per, min((w+1)*per, blocks))
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return 0, err
+	}
+
+	// Any tail shorter than a fill block, rounded down to 4KiB for O_DIRECT.
+	written := blocks * bs
+	if tail := (end - start - written) &^ 4095; tail > 0 {
+		if _, err := f.WriteAt(buf[:tail], start+written); err != nil {
+			return 0, err
+		}
+		written += tail
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
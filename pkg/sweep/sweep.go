@@ -1,6 +1,7 @@
 package sweep
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/runningwild/jolt/pkg/analyze"
@@ -21,7 +22,10 @@ func New(eng engine.Engine, cfg *config.Config) *Sweeper {
 	}
 }
 
-func (s *Sweeper) Run() ([]optimize.HistoryEntry, analyze.Point, error) {
+// Run sweeps the search variable and finds the knee of IOPS against it. If ctx
+// is cancelled it returns the points that finished, and the knee among them,
+// along with the error.
+func (s *Sweeper) Run(ctx context.Context) ([]optimize.HistoryEntry, analyze.Point, error) {
 	// Identify the sweep variable
 	// We expect exactly one variable to have a Range or Values with > 1 item.
 	// If multiple, we might default to the first one or error.
@@ -88,8 +92,11 @@ func (s *Sweeper) Run() ([]optimize.HistoryEntry, analyze.Point, error) {
 		state[sweepVar.Name] = val
 
 		// Run
-		res, score, _, err := s.eval.Evaluate(state)
+		res, score, _, err := s.eval.Evaluate(ctx, state)
 		if err != nil {
+			if ctx.Err() != nil {
+				return results, analyze.FindKnee(points), err
+			}
 			return nil, analyze.Point{}, err
 		}
 
@@ -0,0 +1,86 @@
+package sweep
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runningwild/jolt/pkg/config"
+	"github.com/runningwild/jolt/pkg/engine"
+)
+
+// The simulated device saturates its 32 channels at a queue depth of about
+// 32, so that's where the knee should be.
+func TestSweepSimKnee(t *testing.T) {
+	cfg := &config.Config{
+		Settings: config.Settings{
+			EngineType: "sim",
+			ReadPct:    100,
+			Rand:       true,
+			MinRuntime: time.Second,
+			MaxRuntime: time.Second,
+		},
+		Search: []config.Variable{
+			{Name: "queue_depth", Values: []int{1, 2, 4, 8, 16, 32, 64, 128, 256}},
+			{Name: "workers", Values: []int{4}},
+			{Name: "block_size", Values: []int{4096}},
+		},
+		Objectives: []config.Objective{{Type: "maximize", Metric: "iops"}},
+	}
+
+	history, knee, err := New(engine.NewSim(), cfg).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 9 {
+		t.Fatalf("expected 9 points, got %d", len(history))
+	}
+	if qd := knee.OriginalX.(int); qd < 16 || qd > 64 {
+		t.Errorf("knee at queue depth %d, want 16-64", qd)
+	}
+}
+
+// cancelAfter cancels the sweep's context when the nth run starts.
+type cancelAfter struct {
+	engine.Engine
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Run(ctx context.Context, p engine.Params) (*engine.Result, error) {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.Engine.Run(ctx, p)
+}
+
+func TestSweepCancelled(t *testing.T) {
+	cfg := &config.Config{
+		Settings: config.Settings{
+			EngineType: "sim",
+			ReadPct:    100,
+			Rand:       true,
+			MinRuntime: time.Second,
+			MaxRuntime: time.Second,
+		},
+		Search: []config.Variable{
+			{Name: "queue_depth", Values: []int{1, 2, 4, 8, 16}},
+		},
+		Objectives: []config.Objective{{Type: "maximize", Metric: "iops"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	history, _, err := New(&cancelAfter{Engine: engine.NewSim(), n: 3, cancel: cancel}, cfg).Run(ctx)
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d points, want the 2 that finished", len(history))
+	}
+	for _, h := range history {
+		if h.Result.TerminationReason == "Cancelled" {
+			t.Errorf("cancelled point %v is in the history", h.State)
+		}
+	}
+}